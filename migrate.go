@@ -42,7 +42,35 @@ type MigrationSet struct {
 	IgnoreUnknown bool
 	// DisableCreateTable disable the creation of the migration table
 	DisableCreateTable bool
-}
+	// MigrationApplied, when set, is called after each migration that was
+	// applied successfully, with the time it took.
+	MigrationApplied func(migration *PlannedMigration, dir MigrationDirection, duration time.Duration)
+	// StatementStarted and StatementExecuted, when set, are called before
+	// and after each statement of a migration, the latter with the time it
+	// took and its error.
+	StatementStarted  func(migration *PlannedMigration, statement string)
+	StatementExecuted func(migration *PlannedMigration, statement string, duration time.Duration, err error)
+	// Ordering decides the order the migrations are applied in, and
+	// reverted in reverse.
+	Ordering MigrationOrdering
+	// Dialect, when set, is used for the migration table instead of the
+	// MigrationDialects entry of the dialect, such as a MySQL dialect with
+	// another engine or encoding.
+	Dialect gorp.Dialect
+}
+
+// MigrationOrdering is the order migrations are sorted in by their id.
+type MigrationOrdering int
+
+const (
+	// LexicalOrdering, the default, sorts migrations with a numeric prefix
+	// by that number, before the other ones, and compares the rest of the
+	// ids as strings.
+	LexicalOrdering MigrationOrdering = iota
+	// NumericOrdering compares every run of digits in the ids as a number,
+	// so that v9_users sorts before v10_users, and 2024_9 before 2024_10.
+	NumericOrdering
+)
 
 var migSet = MigrationSet{}
 
@@ -116,6 +144,24 @@ func SetDisableCreateTable(disable bool) {
 	migSet.DisableCreateTable = disable
 }
 
+// SetMigrationApplied sets a function called after each applied migration,
+// for instance to log it.
+func SetMigrationApplied(fn func(migration *PlannedMigration, dir MigrationDirection, duration time.Duration)) {
+	migSet.MigrationApplied = fn
+}
+
+// SetStatementHooks sets the functions called before and after each
+// statement of a migration, for instance to log its progress.
+func SetStatementHooks(started func(migration *PlannedMigration, statement string), executed func(migration *PlannedMigration, statement string, duration time.Duration, err error)) {
+	migSet.StatementStarted = started
+	migSet.StatementExecuted = executed
+}
+
+// SetOrdering sets the order migrations are applied in.
+func SetOrdering(ordering MigrationOrdering) {
+	migSet.Ordering = ordering
+}
+
 // SetIgnoreUnknown sets the flag that skips database check to see if there is a
 // migration in the database that is not in migration source.
 //
@@ -146,6 +192,62 @@ func (m Migration) Less(other *Migration) bool {
 	}
 }
 
+// less reports whether the migration a comes before b in the ordering.
+func (o MigrationOrdering) less(a, b *Migration) bool {
+	if o == NumericOrdering {
+		if c := compareNatural(a.Id, b.Id); c != 0 {
+			return c < 0
+		}
+		return a.Id < b.Id
+	}
+	return a.Less(b)
+}
+
+// SortMigrations sorts the migrations in the given ordering.
+func SortMigrations(migrations []*Migration, ordering MigrationOrdering) {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return ordering.less(migrations[i], migrations[j])
+	})
+}
+
+// compareNatural compares the ids chunk by chunk, runs of digits as numbers
+// and the rest as strings.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ca, cb := naturalChunk(a), naturalChunk(b)
+		a, b = a[len(ca):], b[len(cb):]
+
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				return len(na) - len(nb)
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// naturalChunk returns the leading run of digits, or of other characters.
+func naturalChunk(s string) string {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
 func (m Migration) isNumeric() bool {
 	return len(m.NumberPrefixMatches()) > 0
 }
@@ -531,9 +633,15 @@ func (ms MigrationSet) ExecVersionContext(ctx context.Context, db *sql.DB, diale
 }
 
 // Applies the planned migrations and returns the number of applied migrations.
-func (MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection, migrations []*PlannedMigration, dbMap *gorp.DbMap) (int, error) {
+func (ms MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection, migrations []*PlannedMigration, dbMap *gorp.DbMap) (int, error) {
 	applied := 0
 	for _, migration := range migrations {
+		// Once cancelled, don't start another migration.
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+
+		start := time.Now()
 		var executor SqlExecutor
 		var err error
 
@@ -552,7 +660,7 @@ func (MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection,
 			stmt = strings.TrimSuffix(stmt, "\n")
 			stmt = strings.TrimSuffix(stmt, " ")
 			stmt = strings.TrimSuffix(stmt, ";")
-			if _, err := executor.Exec(stmt); err != nil {
+			if err := ms.execStatement(executor, migration, stmt); err != nil {
 				if trans, ok := executor.(*gorp.Transaction); ok {
 					_ = trans.Rollback()
 				}
@@ -595,12 +703,30 @@ func (MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection,
 			}
 		}
 
+		if ms.MigrationApplied != nil {
+			ms.MigrationApplied(migration, dir, time.Since(start))
+		}
+
 		applied++
 	}
 
 	return applied, nil
 }
 
+// execStatement runs a statement of a migration, between the statement
+// hooks.
+func (ms MigrationSet) execStatement(executor SqlExecutor, migration *PlannedMigration, stmt string) error {
+	if ms.StatementStarted != nil {
+		ms.StatementStarted(migration, stmt)
+	}
+	start := time.Now()
+	_, err := executor.Exec(stmt)
+	if ms.StatementExecuted != nil {
+		ms.StatementExecuted(migration, stmt, time.Since(start), err)
+	}
+	return err
+}
+
 // Plan a migration.
 func PlanMigration(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) ([]*PlannedMigration, *gorp.DbMap, error) {
 	return migSet.PlanMigration(db, dialect, m, dir, max)
@@ -632,6 +758,9 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 	if err != nil {
 		return nil, nil, err
 	}
+	if ms.Ordering != LexicalOrdering {
+		SortMigrations(migrations, ms.Ordering)
+	}
 
 	var migrationRecords []MigrationRecord
 	_, err = dbMap.Select(&migrationRecords, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())))
@@ -646,7 +775,7 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 			Id: migrationRecord.Id,
 		})
 	}
-	sort.Sort(byId(existingMigrations))
+	SortMigrations(existingMigrations, ms.Ordering)
 
 	// Make sure all migrations in the database are among the found migrations which
 	// are to be applied.
@@ -673,7 +802,7 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 	// Add missing migrations up to the last run migration.
 	// This can happen for example when merges happened.
 	if len(existingMigrations) > 0 {
-		result = append(result, ToCatchup(migrations, existingMigrations, record)...)
+		result = append(result, toCatchup(migrations, existingMigrations, record, ms.Ordering)...)
 	}
 
 	// Figure out which migrations to apply
@@ -798,6 +927,10 @@ func ToApply(migrations []*Migration, current string, direction MigrationDirecti
 }
 
 func ToCatchup(migrations, existingMigrations []*Migration, lastRun *Migration) []*PlannedMigration {
+	return toCatchup(migrations, existingMigrations, lastRun, LexicalOrdering)
+}
+
+func toCatchup(migrations, existingMigrations []*Migration, lastRun *Migration, ordering MigrationOrdering) []*PlannedMigration {
 	missing := make([]*PlannedMigration, 0)
 	for _, migration := range migrations {
 		found := false
@@ -807,7 +940,7 @@ func ToCatchup(migrations, existingMigrations []*Migration, lastRun *Migration)
 				break
 			}
 		}
-		if !found && migration.Less(lastRun) {
+		if !found && ordering.less(migration, lastRun) {
 			missing = append(missing, &PlannedMigration{
 				Migration:          migration,
 				Queries:            migration.Up,
@@ -840,6 +973,9 @@ func (ms MigrationSet) GetMigrationRecords(db *sql.DB, dialect string) ([]*Migra
 
 func (ms MigrationSet) getMigrationDbMap(db *sql.DB, dialect string) (*gorp.DbMap, error) {
 	d, ok := MigrationDialects[dialect]
+	if ms.Dialect != nil {
+		d, ok = ms.Dialect, true
+	}
 	if !ok {
 		return nil, fmt.Errorf("Unknown dialect: %s", dialect)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -364,6 +365,60 @@ func (s *SqliteMigrateSuite) TestPlanMigration(c *C) {
 	c.Assert(plannedMigrations[2].Migration, Equals, migrations.Migrations[0])
 }
 
+func (s *SqliteMigrateSuite) TestPlanMigrationNumericOrdering(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "v9_create_table.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Id:   "v10_alter_table.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"},
+			},
+		},
+	}
+	ms := MigrationSet{Ordering: NumericOrdering}
+
+	// Lexically, v10 would come first and fail without the table.
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	migrations.Migrations = append(migrations.Migrations, &Migration{
+		Id:   "v11_add_last_name.sql",
+		Up:   []string{"ALTER TABLE people ADD COLUMN last_name text"},
+		Down: []string{"SELECT 0"},
+	})
+
+	plannedMigrations, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+	c.Assert(plannedMigrations[0].Id, Equals, "v11_add_last_name.sql")
+
+	plannedMigrations, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 2)
+	c.Assert(plannedMigrations[0].Id, Equals, "v10_alter_table.sql")
+	c.Assert(plannedMigrations[1].Id, Equals, "v9_create_table.sql")
+}
+
+func (s *SqliteMigrateSuite) TestMigrationSetDialect(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	_, err := MigrationSet{}.Exec(s.Db, "custom", migrations, Up)
+	c.Assert(err, ErrorMatches, "Unknown dialect: custom")
+
+	ms := MigrationSet{Dialect: gorp.SqliteDialect{}}
+	n, err := ms.Exec(s.Db, "custom", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
 func (s *SqliteMigrateSuite) TestSkipMigration(c *C) {
 	migrations := &MemoryMigrationSource{
 		Migrations: []*Migration{
@@ -712,6 +767,50 @@ func (s *SqliteMigrateSuite) TestRunMigrationObjOtherTable(c *C) {
 	c.Assert(n, Equals, 0)
 }
 
+func (s *SqliteMigrateSuite) TestMigrationApplied(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations,
+	}
+
+	var applied []string
+	ms := MigrationSet{
+		MigrationApplied: func(migration *PlannedMigration, dir MigrationDirection, duration time.Duration) {
+			c.Assert(dir, Equals, Up)
+			c.Assert(duration >= 0, Equals, true)
+			applied = append(applied, migration.Id)
+		},
+	}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(applied, DeepEquals, []string{"123", "124"})
+}
+
+func (s *SqliteMigrateSuite) TestStatementHooks(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id: "123",
+				Up: []string{"CREATE TABLE people (id int)", "CREATE TABLE people (id int)"},
+			},
+		},
+	}
+
+	var started, executed []string
+	ms := MigrationSet{
+		StatementStarted: func(migration *PlannedMigration, statement string) {
+			started = append(started, migration.Id+": "+statement)
+		},
+		StatementExecuted: func(migration *PlannedMigration, statement string, duration time.Duration, err error) {
+			executed = append(executed, fmt.Sprintf("%s: %v", statement, err))
+		},
+	}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, NotNil)
+	c.Assert(started, DeepEquals, []string{"123: CREATE TABLE people (id int)", "123: CREATE TABLE people (id int)"})
+	c.Assert(executed, DeepEquals, []string{"CREATE TABLE people (id int): <nil>", "CREATE TABLE people (id int): table people already exists"})
+}
+
 func (*SqliteMigrateSuite) TestSetDisableCreateTable(c *C) {
 	c.Assert(migSet.DisableCreateTable, Equals, false)
 
@@ -813,6 +912,22 @@ func (s *SqliteMigrateSuite) TestContextTimeout(c *C) {
 	c.Assert(n, Equals, 2)
 }
 
+func (s *SqliteMigrateSuite) TestContextCancelledBeforeMigration(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+	n, err := ExecContext(ctx, s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(n, Equals, 0)
+
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+}
+
 //go:embed test-migrations/*
 var testEmbedFS embed.FS
 
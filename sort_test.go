@@ -34,3 +34,34 @@ func (*SortSuite) TestSortMigrations(c *C) {
 	c.Assert(migrations[6].Id, Equals, "120_cde")
 	c.Assert(migrations[7].Id, Equals, "efg")
 }
+
+func (*SortSuite) TestSortMigrationsNumeric(c *C) {
+	migrations := []*Migration{
+		{Id: "v10_users.sql"},
+		{Id: "2024_10_orders.sql"},
+		{Id: "v9_users.sql"},
+		{Id: "2024_9_orders.sql"},
+		{Id: "v09_roles.sql"},
+		{Id: "2024_09_index.sql"},
+	}
+
+	SortMigrations(migrations, NumericOrdering)
+	ids := make([]string, len(migrations))
+	for i, m := range migrations {
+		ids[i] = m.Id
+	}
+	c.Assert(ids, DeepEquals, []string{
+		"2024_09_index.sql",
+		"2024_9_orders.sql",
+		"2024_10_orders.sql",
+		"v09_roles.sql",
+		"v9_users.sql",
+		"v10_users.sql",
+	})
+
+	// The default keeps sorting by numeric prefix, then as strings.
+	SortMigrations(migrations, LexicalOrdering)
+	c.Assert(migrations[0].Id, Equals, "2024_09_index.sql")
+	c.Assert(migrations[3].Id, Equals, "v09_roles.sql")
+	c.Assert(migrations[4].Id, Equals, "v10_users.sql")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// auditRecord is a row of the audit table, written for every migration
+// applied or reverted. Unlike the migration table, rows are never deleted.
+type auditRecord struct {
+	Id          int64     `db:"id"`
+	MigrationId string    `db:"migration_id"`
+	Direction   string    `db:"direction"`
+	AppliedAt   time.Time `db:"applied_at"`
+	OsUser      string    `db:"os_user"`
+	Actor       string    `db:"actor"`
+}
+
+// auditLog writes the audit rows of a run to the audit table of the
+// environment.
+type auditLog struct {
+	dbMap  *gorp.DbMap
+	table  string
+	osUser string
+	actor  string
+}
+
+// openAuditLog returns the audit log of the environment, creating its table
+// when missing, or nil when the environment sets no audittable.
+func openAuditLog(db *sql.DB, env *Environment) (*auditLog, error) {
+	if env.AuditTable == "" {
+		return nil, nil
+	}
+
+	dbMap := &gorp.DbMap{Db: db, Dialect: environmentDialect(env)}
+	dbMap.AddTableWithNameAndSchema(auditRecord{}, env.SchemaName, env.AuditTable).SetKeys(true, "Id")
+	if !env.DisableCreateTable {
+		if err := dbMap.CreateTablesIfNotExists(); err != nil {
+			return nil, fmt.Errorf("cannot create the audit table: %w", err)
+		}
+	}
+
+	table := env.AuditTable
+	if env.SchemaName != "" {
+		table = env.SchemaName + "." + table
+	}
+	return &auditLog{dbMap: dbMap, table: table, osUser: osUser(), actor: env.Actor}, nil
+}
+
+// osUser returns the name of the user running the migrations.
+func osUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// wrap returns a MigrationApplied hook that writes the audit row of each
+// migration, then calls applied. The migration is committed by then, so a
+// failure to write the row is a warning.
+func (a *auditLog) wrap(applied func(*migrate.PlannedMigration, migrate.MigrationDirection, time.Duration)) func(*migrate.PlannedMigration, migrate.MigrationDirection, time.Duration) {
+	if a == nil {
+		return applied
+	}
+	return func(migration *migrate.PlannedMigration, dir migrate.MigrationDirection, duration time.Duration) {
+		record := &auditRecord{
+			MigrationId: migration.Id,
+			Direction:   directionName(dir),
+			AppliedAt:   time.Now().UTC(),
+			OsUser:      a.osUser,
+			Actor:       a.actor,
+		}
+		if err := a.dbMap.Insert(record); err != nil {
+			ui.Warn(fmt.Sprintf("Cannot write the audit row of migration %s to %s: %s", migration.Id, a.table, err))
+		}
+		applied(migration, dir, duration)
+	}
+}
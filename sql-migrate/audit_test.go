@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestAuditTable(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	ui = cli.NewMockUi()
+	defer setenv("TEST_ACTOR", "octocat")()
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+  audittable: migration_audit
+  actor: ${TEST_ACTOR}
+`)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Actor, Equals, "octocat")
+	_, err = applyMigrations(context.Background(), env, migrate.Up, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	_, err = applyMigrations(context.Background(), env, migrate.Down, false, 1, -1, "")
+	c.Assert(err, IsNil)
+
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	rows, err := db.Query("SELECT migration_id, direction, os_user, actor FROM migration_audit ORDER BY id")
+	c.Assert(err, IsNil)
+	defer rows.Close()
+	var audit []string
+	for rows.Next() {
+		var id, direction, user, actor string
+		c.Assert(rows.Scan(&id, &direction, &user, &actor), IsNil)
+		c.Assert(user, Equals, osUser())
+		audit = append(audit, id+" "+direction+" "+actor)
+	}
+	c.Assert(rows.Err(), IsNil)
+	c.Assert(audit, DeepEquals, []string{
+		"1_initial.sql up octocat",
+		"2_record.sql up octocat",
+		"2_record.sql down octocat",
+	})
+}
+
+func (*ConfigSuite) TestAuditTableActor(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  actor: octocat
+`)
+	_, err := GetEnvironment()
+	c.Assert(err, ErrorMatches, "actor needs audittable")
+}
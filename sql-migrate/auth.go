@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// authTokenProvider generates a short-lived token that is used as the
+// password when connecting to endpoint (host:port) as user.
+type authTokenProvider func(ctx context.Context, endpoint, user string) (string, error)
+
+// authTokenProviders holds the providers compiled in, keyed by auth mode.
+var authTokenProviders = map[string]authTokenProvider{}
+
+// authModes maps the supported auth modes to the build tag that enables
+// them.
+var authModes = map[string]string{
+	"iam": "aws",
+}
+
+// defaultPorts is used to build the token endpoint when no port is set.
+var defaultPorts = map[string]string{
+	"mysql":    "3306",
+	"postgres": "5432",
+}
+
+func validateAuth(env *Environment) error {
+	if env.Auth == "" {
+		return nil
+	}
+
+	if _, ok := authModes[env.Auth]; !ok {
+		return fmt.Errorf("unknown auth mode %q", env.Auth)
+	}
+
+	if env.Password != "" {
+		return fmt.Errorf("password cannot be set with auth %s", env.Auth)
+	}
+
+	if (env.DataSource != "" && secretScheme(env.DataSource) == "") || len(env.Shards) > 0 {
+		return fmt.Errorf("auth %s needs host, port, user and dbname instead of a data source", env.Auth)
+	}
+
+	return nil
+}
+
+// withAuthToken returns a copy of the environment with a freshly generated
+// token as the password. Tokens expire quickly, so this is done right
+// before connecting.
+func withAuthToken(ctx context.Context, env *Environment) (*Environment, error) {
+	provide, ok := authTokenProviders[env.Auth]
+	if !ok {
+		return nil, fmt.Errorf("auth %s is not supported by this build, rebuild with -tags %s", env.Auth, authModes[env.Auth])
+	}
+
+	port, ok := defaultPorts[driverName(env.Dialect)]
+	if !ok {
+		return nil, fmt.Errorf("auth %s is not supported for dialect %s", env.Auth, env.Dialect)
+	}
+	if env.Port != "" {
+		port = env.Port
+	}
+
+	if env.Host == "" || env.User == "" {
+		return nil, errors.New("auth " + env.Auth + " needs a host and a user")
+	}
+
+	token, err := provide(ctx, net.JoinHostPort(env.Host, port), env.User)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate auth token: %w", err)
+	}
+
+	conn := *env
+	conn.Port = port
+	conn.Password = token
+	conn.DataSource, err = BuildDataSource(&conn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
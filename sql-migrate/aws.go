@@ -0,0 +1,151 @@
+//go:build aws
+
+// The AWS integrations pull in a large part of the AWS SDK, so they are only
+// compiled in when building with -tags aws.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+func init() {
+	secretResolvers["awssecret"] = resolveAwsSecret
+	authTokenProviders["iam"] = rdsAuthToken
+	remoteStores["s3"] = newS3Store
+}
+
+// loadAwsConfig loads the AWS configuration from the default credential
+// chain, with the profile given by -aws-profile if any.
+func loadAwsConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, awsConfigOptions()...)
+	if err != nil {
+		return cfg, err
+	}
+
+	if cfg.Region == "" {
+		return cfg, errors.New("no AWS region configured, set AWS_REGION or configure a profile")
+	}
+
+	return cfg, nil
+}
+
+// awsConfigOptions returns the options of loadAwsConfig. Without
+// -aws-profile, the SDK reads AWS_PROFILE itself.
+func awsConfigOptions() []func(*config.LoadOptions) error {
+	if AwsProfile == "" {
+		return nil
+	}
+	return []func(*config.LoadOptions) error{config.WithSharedConfigProfile(AwsProfile)}
+}
+
+func resolveAwsSecret(ctx context.Context, id string) (string, error) {
+	cfg, err := loadAwsConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if out.SecretString == nil {
+		return "", errors.New("secret " + id + " has no string value")
+	}
+
+	return *out.SecretString, nil
+}
+
+// rdsAuthToken generates an IAM authentication token for RDS, valid for 15
+// minutes.
+func rdsAuthToken(ctx context.Context, endpoint, user string) (string, error) {
+	cfg, err := loadAwsConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return auth.BuildAuthToken(ctx, endpoint, cfg.Region, user, cfg.Credentials)
+}
+
+// s3Store reads the migration files of s3://bucket/prefix dirs.
+type s3Store struct {
+	client *s3.Client
+}
+
+func newS3Store(ctx context.Context) (remoteStore, error) {
+	cfg, err := loadAwsConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{client: s3.NewFromConfig(cfg)}, nil
+}
+
+func (s *s3Store) List(ctx context.Context, bucket, prefix string) ([]remoteObject, error) {
+	var objects []remoteObject
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err, bucket)
+		}
+		for _, object := range page.Contents {
+			name := path.Base(aws.ToString(object.Key))
+			if !strings.HasSuffix(name, ".sql") {
+				continue
+			}
+			objects = append(objects, remoteObject{
+				Name:     name,
+				Size:     aws.ToInt64(object.Size),
+				Modified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err, bucket)
+	}
+	return out.Body, nil
+}
+
+// s3Error explains the errors of a missing bucket or object, and of denied
+// access, which the SDK reports by their code only.
+func s3Error(err error, bucket string) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "Forbidden":
+		return fmt.Errorf("access denied to bucket %s, check the AWS credentials and the bucket policy: %w", bucket, err)
+	case "NoSuchBucket":
+		return fmt.Errorf("bucket %s does not exist: %w", bucket, err)
+	case "NoSuchKey", "NotFound":
+		return fmt.Errorf("the object was removed from bucket %s: %w", bucket, err)
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build aws
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestLoadAwsConfigProfile(c *C) {
+	file := filepath.Join(c.MkDir(), "config")
+	c.Assert(os.WriteFile(file, []byte("[default]\nregion = eu-west-1\n\n[profile staging]\nregion = eu-west-3\n"), 0o600), IsNil)
+	defer setenv("AWS_CONFIG_FILE", file)()
+	defer setenv("AWS_PROFILE", "")()
+	defer setenv("AWS_REGION", "")()
+	defer setenv("AWS_DEFAULT_REGION", "")()
+	defer func() { AwsProfile = "" }()
+
+	cfg, err := loadAwsConfig(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Region, Equals, "eu-west-1")
+
+	AwsProfile = "staging"
+	cfg, err = loadAwsConfig(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Region, Equals, "eu-west-3")
+
+	AwsProfile = "missing"
+	_, err = loadAwsConfig(context.Background())
+	c.Assert(err, ErrorMatches, ".*missing.*")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// ContinueOnError carries on with the next environments when one of those
+// listed in -env fails.
+var ContinueOnError bool
+
+// environmentNames returns the environments listed in -env, separated by
+// commas.
+func environmentNames(value string) ([]string, error) {
+	names := strings.Split(value, ",")
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.New("-env lists an empty environment name")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("-env lists environment %s twice", name)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// applyEnvironmentMigrations migrates the environments in order, each with
+// its own connection and migration table, and prints a summary of them. It
+// stops at the first one that fails, unless -continue-on-error is set.
+func applyEnvironmentMigrations(ctx context.Context, names []string, dir migrate.MigrationDirection, dryrun bool, limit int, version int64, target string) (int, error) {
+	// Each environment would overwrite the file of the previous one.
+	if OutFile != "" {
+		return 0, errors.New("-out cannot be used with several environments")
+	}
+	if MetricsFile != "" {
+		return 0, errors.New("-metrics-file cannot be used with several environments")
+	}
+	if PrintDataSource {
+		return 0, errors.New("-print-dsn cannot be used with several environments")
+	}
+
+	defer func(name string) { ConfigEnvironment = name }(ConfigEnvironment)
+
+	summary := make([]string, len(names))
+	for i := range summary {
+		summary[i] = "not run"
+	}
+
+	total, failed := 0, 0
+	for i, name := range names {
+		ui.Output(fmt.Sprintf("==> Environment %d of %d: %s", i+1, len(names), name))
+		ConfigEnvironment = name
+		n, err := applyEnvironment(ctx, dir, dryrun, limit, version, target)
+		total += n
+		if err != nil {
+			failed++
+			summary[i] = "failed: " + err.Error()
+			ui.Error(fmt.Sprintf("Environment %s failed: %s", name, err))
+			if !ContinueOnError || interrupted(ctx) {
+				break
+			}
+			continue
+		}
+		if n == 1 {
+			summary[i] = "1 migration"
+		} else {
+			summary[i] = fmt.Sprintf("%d migrations", n)
+		}
+	}
+
+	ui.Output("==> Summary")
+	for i, name := range names {
+		ui.Output(fmt.Sprintf("%s: %s", name, summary[i]))
+	}
+	if failed > 0 {
+		return total, fmt.Errorf("%d of %d environments failed", failed, len(names))
+	}
+	return total, nil
+}
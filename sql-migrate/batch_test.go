@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestEnvironmentNames(c *C) {
+	names, err := environmentNames("development, staging,replica")
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"development", "staging", "replica"})
+
+	_, err = environmentNames("development,")
+	c.Assert(err, ErrorMatches, "-env lists an empty environment name")
+	_, err = environmentNames("staging,development,staging")
+	c.Assert(err, ErrorMatches, "-env lists environment staging twice")
+}
+
+func (*ConfigSuite) TestApplyMigrationsEnvironments(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := c.MkDir()
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(dir, "development.db")+`
+  dir: ../test-migrations
+  table: development_migrations
+broken:
+  dialect: sqlite3
+  datasource: `+filepath.Join(dir, "missing", "broken.db")+`
+  dir: ../test-migrations
+staging:
+  dialect: sqlite3
+  datasource: `+filepath.Join(dir, "staging.db")+`
+  dir: ../test-migrations
+`)
+
+	ConfigEnvironment = "development,broken,staging"
+	n, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "1 of 3 environments failed")
+	c.Assert(n, Equals, 2)
+	c.Assert(ConfigEnvironment, Equals, "development,broken,staging")
+	c.Assert(mock.OutputWriter.String(), Matches, `(?s)==> Environment 1 of 3: development
+.*==> Environment 2 of 3: broken
+==> Summary
+development: 2 migrations
+broken: failed: cannot ping database: .*
+staging: not run
+`)
+
+	// Each environment has its own migration table.
+	mock.OutputWriter.Reset()
+	ContinueOnError = true
+	defer func() { ContinueOnError = false }()
+	n, err = ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "1 of 3 environments failed")
+	c.Assert(n, Equals, 2)
+	c.Assert(mock.OutputWriter.String(), Matches, `(?s).*==> Summary
+development: 0 migrations
+broken: failed: .*
+staging: 2 migrations
+`)
+
+	ConfigEnvironment = "staging"
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, dialect, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	applied, err := appliedMigrationIds(db, dialect, env)
+	c.Assert(err, IsNil)
+	c.Assert(applied, HasLen, 2)
+	c.Assert(migrationTableExists(db, env), Equals, true)
+
+	ConfigEnvironment = "development,staging"
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "-env lists several environments, which only up and down support")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-gorp/gorp/v3"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// checksumRecord stores the checksum of an applied migration. Checksums are
+// kept in their own table, next to the migration table, so that the
+// migration table itself keeps the layout the migrate package expects.
+type checksumRecord struct {
+	Id       string `db:"id"`
+	Checksum string `db:"checksum"`
+}
+
+// checksumTableName returns the name of the table holding the checksums.
+func checksumTableName(env *Environment) string {
+	return migrationTableName(env) + "_checksums"
+}
+
+// migrationChecksum hashes the statements of a migration, in both
+// directions.
+func migrationChecksum(m *migrate.Migration) string {
+	h := sha256.New()
+	for _, stmt := range m.Up {
+		_, _ = fmt.Fprintf(h, "%d:%s", len(stmt), stmt)
+	}
+	h.Write([]byte{0})
+	for _, stmt := range m.Down {
+		_, _ = fmt.Fprintf(h, "%d:%s", len(stmt), stmt)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func checksumDbMap(db *sql.DB, env *Environment) *gorp.DbMap {
+	dbMap := &gorp.DbMap{Db: db, Dialect: environmentDialect(env)}
+	dbMap.AddTableWithNameAndSchema(checksumRecord{}, env.SchemaName, checksumTableName(env)).SetKeys(false, "Id")
+	return dbMap
+}
+
+func checksumTableExists(db *sql.DB, env *Environment) bool {
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE 1 = 0", environmentDialect(env).QuotedTableForQuery(env.SchemaName, checksumTableName(env)))
+	rows, err := db.Query(query)
+	if err != nil {
+		return false
+	}
+	_ = rows.Close()
+	return true
+}
+
+func readChecksums(dbMap *gorp.DbMap, env *Environment) (map[string]string, error) {
+	var records []checksumRecord
+	_, err := dbMap.Select(&records, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(env.SchemaName, checksumTableName(env))))
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[string]string, len(records))
+	for _, r := range records {
+		checksums[r.Id] = r.Checksum
+	}
+	return checksums, nil
+}
+
+// appliedMigrations returns the migrations that are applied.
+func appliedMigrations(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource) ([]*migrate.Migration, error) {
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]bool, len(records))
+	for _, r := range records {
+		applied[r.Id] = true
+	}
+
+	result := make([]*migrate.Migration, 0, len(records))
+	for _, m := range migrations {
+		if applied[m.Id] {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// RecordChecksums stores the checksums of the applied migrations, creating
+// the checksum table when needed. With overwrite, existing checksums are
+// replaced, which accepts changes made to applied migrations. Checksums of
+// migrations that are no longer applied are removed.
+func RecordChecksums(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource, overwrite bool) (int, error) {
+	applied, err := appliedMigrations(db, dialect, env, source)
+	if err != nil {
+		return 0, err
+	}
+
+	dbMap := checksumDbMap(db, env)
+	if err := dbMap.CreateTablesIfNotExists(); err != nil {
+		return 0, err
+	}
+
+	checksums, err := readChecksums(dbMap, env)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := dbMap.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	for _, m := range applied {
+		record := &checksumRecord{Id: m.Id, Checksum: migrationChecksum(m)}
+		existing, ok := checksums[m.Id]
+		delete(checksums, m.Id)
+
+		switch {
+		case !ok:
+			err = tx.Insert(record)
+		case overwrite && existing != record.Checksum:
+			_, err = tx.Update(record)
+		default:
+			continue
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		recorded++
+	}
+
+	for id := range checksums {
+		if _, err := tx.Delete(&checksumRecord{Id: id}); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return recorded, tx.Commit()
+}
+
+// syncChecksums keeps the checksums up to date after migrating, once they
+// have been recorded with verify -record.
+func syncChecksums(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource) error {
+	if !checksumTableExists(db, env) {
+		return nil
+	}
+
+	_, err := RecordChecksums(db, dialect, env, source, false)
+	if err != nil {
+		return fmt.Errorf("Cannot record checksums: %w", err)
+	}
+	return nil
+}
+
+// forgetChecksums removes the checksums of the given migrations, so that
+// syncChecksums records them again.
+func forgetChecksums(db *sql.DB, env *Environment, migrations []*migrate.PlannedMigration) error {
+	if !checksumTableExists(db, env) {
+		return nil
+	}
+
+	dbMap := checksumDbMap(db, env)
+	for _, m := range migrations {
+		if _, err := dbMap.Delete(&checksumRecord{Id: m.Id}); err != nil {
+			return fmt.Errorf("Cannot record checksums: %w", err)
+		}
+	}
+	return nil
+}
+
+// ChecksumDrift describes an applied migration whose file changed.
+type ChecksumDrift struct {
+	Id       string
+	Recorded string
+	Current  string
+}
+
+// VerifyChecksums compares the applied migrations with their recorded
+// checksums. It returns the migrations that changed, and those without a
+// checksum.
+func VerifyChecksums(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource) ([]ChecksumDrift, []string, error) {
+	if !checksumTableExists(db, env) {
+		return nil, nil, fmt.Errorf("No checksums have been recorded in %s yet, run verify -record first", checksumTableName(env))
+	}
+
+	applied, err := appliedMigrations(db, dialect, env, source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checksums, err := readChecksums(checksumDbMap(db, env), env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var drift []ChecksumDrift
+	var missing []string
+	for _, m := range applied {
+		recorded, ok := checksums[m.Id]
+		if !ok {
+			missing = append(missing, m.Id)
+			continue
+		}
+		if current := migrationChecksum(m); !strings.EqualFold(current, recorded) {
+			drift = append(drift, ChecksumDrift{Id: m.Id, Recorded: recorded, Current: current})
+		}
+	}
+	return drift, missing, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type ChecksumSuite struct {
+	db     *sql.DB
+	env    *Environment
+	source *migrate.MemoryMigrationSource
+}
+
+var _ = Suite(&ChecksumSuite{})
+
+func (s *ChecksumSuite) SetUpTest(c *C) {
+	var err error
+	s.db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+	s.db.SetMaxOpenConns(1)
+
+	s.env = &Environment{Dialect: "sqlite3", TableName: "checksum_migrations"}
+	migrate.SetTable(s.env.TableName)
+	migrate.SetSchema("")
+
+	s.source = &migrate.MemoryMigrationSource{Migrations: []*migrate.Migration{
+		{Id: "1_initial.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+		{Id: "2_record.sql", Up: []string{"INSERT INTO people (id) VALUES (1)"}, Down: []string{"DELETE FROM people"}},
+	}}
+}
+
+func (s *ChecksumSuite) TearDownTest(c *C) {
+	c.Assert(s.db.Close(), IsNil)
+}
+
+func (*ChecksumSuite) TestMigrationChecksum(c *C) {
+	m := &migrate.Migration{Up: []string{"CREATE TABLE a (id int)"}, Down: []string{"DROP TABLE a"}}
+	c.Assert(migrationChecksum(m), Equals, migrationChecksum(&migrate.Migration{Up: m.Up, Down: m.Down}))
+
+	// Statements moving between directions change the checksum.
+	c.Assert(migrationChecksum(m), Not(Equals), migrationChecksum(&migrate.Migration{Up: append(m.Up, m.Down...)}))
+}
+
+func (s *ChecksumSuite) TestVerifyChecksums(c *C) {
+	_, _, err := VerifyChecksums(s.db, "sqlite3", s.env, s.source)
+	c.Assert(err, ErrorMatches, "No checksums have been recorded in checksum_migrations_checksums yet, run verify -record first")
+
+	_, err = migrate.ExecMax(s.db, "sqlite3", s.source, migrate.Up, 1)
+	c.Assert(err, IsNil)
+
+	n, err := RecordChecksums(s.db, "sqlite3", s.env, s.source, false)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Applying records the checksums once the table exists.
+	_, err = migrate.Exec(s.db, "sqlite3", s.source, migrate.Up)
+	c.Assert(err, IsNil)
+	c.Assert(syncChecksums(s.db, "sqlite3", s.env, s.source), IsNil)
+
+	drift, missing, err := VerifyChecksums(s.db, "sqlite3", s.env, s.source)
+	c.Assert(err, IsNil)
+	c.Assert(drift, HasLen, 0)
+	c.Assert(missing, HasLen, 0)
+
+	s.source.Migrations[1].Up = []string{"INSERT INTO people (id) VALUES (2)"}
+	drift, _, err = VerifyChecksums(s.db, "sqlite3", s.env, s.source)
+	c.Assert(err, IsNil)
+	c.Assert(drift, HasLen, 1)
+	c.Assert(drift[0].Id, Equals, "2_record.sql")
+
+	// Recording without overwriting keeps the drift visible.
+	_, err = RecordChecksums(s.db, "sqlite3", s.env, s.source, false)
+	c.Assert(err, IsNil)
+	drift, _, err = VerifyChecksums(s.db, "sqlite3", s.env, s.source)
+	c.Assert(err, IsNil)
+	c.Assert(drift, HasLen, 1)
+
+	n, err = RecordChecksums(s.db, "sqlite3", s.env, s.source, true)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	drift, _, err = VerifyChecksums(s.db, "sqlite3", s.env, s.source)
+	c.Assert(err, IsNil)
+	c.Assert(drift, HasLen, 0)
+}
+
+func (s *ChecksumSuite) TestSyncChecksumsAfterDown(c *C) {
+	_, err := migrate.Exec(s.db, "sqlite3", s.source, migrate.Up)
+	c.Assert(err, IsNil)
+	_, err = RecordChecksums(s.db, "sqlite3", s.env, s.source, false)
+	c.Assert(err, IsNil)
+
+	_, err = migrate.ExecMax(s.db, "sqlite3", s.source, migrate.Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(syncChecksums(s.db, "sqlite3", s.env, s.source), IsNil)
+
+	checksums, err := readChecksums(checksumDbMap(s.db, s.env), s.env)
+	c.Assert(err, IsNil)
+	c.Assert(checksums, HasLen, 1)
+	c.Assert(checksums["1_initial.sql"], Equals, migrationChecksum(s.source.Migrations[0]))
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type ApplyCommand struct{}
+
+func (*ApplyCommand) Help() string {
+	helpText := `
+Usage: sql-migrate apply [options] <migration> [options]
+
+  Run the up (or with -down, the down) part of a single migration,
+  regardless of the order, and record it as applied (or reverted). The
+  migration is given by its id, id without .sql or numeric prefix.
+
+  The earlier migrations must be applied, and when reverting, the later ones
+  must not be, unless -force is given. Use with care: the other commands
+  expect the migrations to be applied in order.
+
+Options:
+
+  -up                    Run the up part of the migration, the default.
+  -down                  Run the down part of the migration.
+  -force                 Run the migration even if the migrations before it are
+                         not applied, or those after it are.
+  -dryrun, -dry-run      Don't apply the migration, just print it.
+  -verbose-sql           Log each statement before it runs, and its duration
+                         after it, even without -v.
+  -lock-timeout=5m       Maximum time to wait for another migration run to finish
+                         (0 = no limit).
+  -force-unlock          Break a lock table entry older than the lockttl of the
+                         environment.
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp, promptHelp)
+}
+
+func (*ApplyCommand) Synopsis() string {
+	return "Run a single migration, regardless of the order"
+}
+
+func (c *ApplyCommand) Run(args []string) int {
+	var up, down, force, dryrun bool
+
+	cmdFlags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&up, "up", false, "Run the up part of the migration, the default.")
+	cmdFlags.BoolVar(&down, "down", false, "Run the down part of the migration.")
+	cmdFlags.BoolVar(&force, "force", false, "Run the migration even if it is out of order.")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply the migration, just print it.")
+	cmdFlags.BoolVar(&dryrun, "dry-run", false, "Alias of -dryrun.")
+	cmdFlags.BoolVar(&VerboseSql, "verbose-sql", false, "Log each statement before it runs, and its duration after it.")
+	cmdFlags.DurationVar(&LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another migration run to finish (0 = no limit).")
+	cmdFlags.BoolVar(&ForceUnlock, "force-unlock", false, "Break a lock table entry older than the lockttl of the environment.")
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+	promptFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	// The flags may follow the migration as well: apply 0007 -down.
+	var names []string
+	for cmdFlags.NArg() > 0 {
+		names = append(names, cmdFlags.Arg(0))
+		if err := cmdFlags.Parse(cmdFlags.Args()[1:]); err != nil {
+			return 1
+		}
+	}
+
+	if len(names) != 1 {
+		ui.Error("Give the migration to apply")
+		return 1
+	}
+	if up && down {
+		ui.Error("Give either -up or -down, not both")
+		return 1
+	}
+
+	dir := migrate.Up
+	if down {
+		dir = migrate.Down
+	}
+
+	ctx, stop, err := interruptContext()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer stop()
+
+	err = ApplyMigration(ctx, names[0], dir, force, dryrun)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// ApplyMigration runs a single migration in the given direction and records
+// it. Unless forced, it has to be the next one to apply, or when reverting,
+// the last one applied.
+func ApplyMigration(ctx context.Context, name string, dir migrate.MigrationDirection, force, dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	var hooks *hookSet
+	if !dryrun {
+		if hooks, err = loadHookSet(env); err != nil {
+			return err
+		}
+	}
+
+	db, dialect, err := GetConnectionContext(ctx, env)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if !dryrun {
+		hooks.pinConnection(db)
+		unlock, err := lockMigrations(ctx, db, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	source := migrationSource(env)
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	id, err := findMigrationId(migrations, name)
+	if err != nil {
+		return err
+	}
+
+	var dbMap *gorp.DbMap
+	if !dryrun {
+		if err := createSchemas(ctx, db, env); err != nil {
+			return err
+		}
+		// Creates the migration table when needed, and checks for unknown
+		// migrations in it.
+		if _, dbMap, err = environmentMigrationSet(env).PlanMigration(db, dialect, source, migrate.Up, 0); err != nil {
+			return fmt.Errorf("Cannot plan migration: %w", err)
+		}
+	}
+
+	applied, err := appliedMigrationIds(db, dialect, env)
+	if err != nil {
+		return err
+	}
+
+	m, err := checkApplyOrder(migrations, applied, id, dir, force)
+	if err != nil {
+		return err
+	}
+
+	if dryrun {
+		PrintMigration(m, dir)
+		return nil
+	}
+
+	if err := confirmProduction(env, fmt.Sprintf("Run migration %s (%s)", id, directionName(dir))); err != nil {
+		return err
+	}
+
+	audit, err := openAuditLog(db, env)
+	if err != nil {
+		return err
+	}
+
+	if err := hooks.runBefore(ctx, db); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = execMigration(ctx, dbMap, m, dir)
+	if err == nil {
+		audit.wrap(logMigrationApplied)(m, dir, time.Since(start))
+	}
+
+	// The after hooks run even when the migration failed, to undo what the
+	// before hooks did.
+	hookErr := hooks.runAfter(ctx, db)
+	if err != nil {
+		if hookErr != nil {
+			ui.Warn(hookErr.Error())
+		}
+		if interrupted(ctx) {
+			return interruptedError(ctx, err, dir, 0)
+		}
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+
+	if err := syncChecksums(db, dialect, env, source); err != nil {
+		return err
+	}
+
+	if dir == migrate.Up {
+		ui.Output(colorApplied.Sprintf("Applied migration %s", id))
+	} else {
+		ui.Output(fmt.Sprintf("Reverted migration %s", id))
+	}
+
+	if hookErr != nil {
+		return fmt.Errorf("%w, the migration is kept", hookErr)
+	}
+	return nil
+}
+
+// appliedMigrationIds returns the ids of the applied migrations, none when
+// the migration table doesn't exist yet.
+func appliedMigrationIds(db *sql.DB, dialect string, env *Environment) (map[string]bool, error) {
+	applied := map[string]bool{}
+	if !migrationTableExists(db, env) {
+		return applied, nil
+	}
+
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		applied[r.Id] = true
+	}
+	return applied, nil
+}
+
+// checkApplyOrder plans the migration with the given id in the given
+// direction. It must not be applied yet to run it up, and must be applied to
+// run it down. Unless forced, the migrations before it must be applied when
+// running it up, and the ones after it must not be when running it down.
+func checkApplyOrder(migrations []*migrate.Migration, applied map[string]bool, id string, dir migrate.MigrationDirection, force bool) (*migrate.PlannedMigration, error) {
+	index := -1
+	for i, m := range migrations {
+		if m.Id == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("Unknown migration %s", id)
+	}
+	m := migrations[index]
+
+	var outOfOrder []string
+	if dir == migrate.Up {
+		if applied[id] {
+			return nil, fmt.Errorf("Migration %s is already applied", id)
+		}
+		for _, earlier := range migrations[:index] {
+			if !applied[earlier.Id] {
+				outOfOrder = append(outOfOrder, earlier.Id)
+			}
+		}
+		if len(outOfOrder) > 0 && !force {
+			return nil, fmt.Errorf("Migration %s comes after migrations that are not applied (%s), apply them first or pass -force", id, strings.Join(outOfOrder, ", "))
+		}
+		return &migrate.PlannedMigration{Migration: m, Queries: m.Up, DisableTransaction: m.DisableTransactionUp}, nil
+	}
+
+	if !applied[id] {
+		return nil, fmt.Errorf("Migration %s is not applied", id)
+	}
+	for _, later := range migrations[index+1:] {
+		if applied[later.Id] {
+			outOfOrder = append(outOfOrder, later.Id)
+		}
+	}
+	if len(outOfOrder) > 0 && !force {
+		return nil, fmt.Errorf("Migration %s comes before migrations that are applied (%s), revert them first or pass -force", id, strings.Join(outOfOrder, ", "))
+	}
+	return &migrate.PlannedMigration{Migration: m, Queries: m.Down, DisableTransaction: m.DisableTransactionDown}, nil
+}
+
+// execMigration runs the statements of a planned migration and records it,
+// in a transaction unless it is marked notransaction, like the migrate
+// package does.
+func execMigration(ctx context.Context, dbMap *gorp.DbMap, m *migrate.PlannedMigration, dir migrate.MigrationDirection) error {
+	var executor gorp.SqlExecutor = dbMap.WithContext(ctx)
+	var tx *gorp.Transaction
+	if !m.DisableTransaction {
+		var err error
+		if tx, err = dbMap.Begin(); err != nil {
+			return &migrate.TxError{Migration: m.Migration, Err: err}
+		}
+		executor = tx.WithContext(ctx)
+	}
+
+	fail := func(err error) error {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+		return &migrate.TxError{Migration: m.Migration, Err: err}
+	}
+
+	for _, stmt := range m.Queries {
+		if err := execStatement(executor, m, trimStatement(stmt)); err != nil {
+			return fail(err)
+		}
+	}
+
+	var err error
+	if dir == migrate.Up {
+		err = executor.Insert(&migrate.MigrationRecord{Id: m.Id, AppliedAt: time.Now()})
+	} else {
+		_, err = executor.Delete(&migrate.MigrationRecord{Id: m.Id})
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return &migrate.TxError{Migration: m.Migration, Err: err}
+		}
+	}
+	return nil
+}
+
+// execStatement runs a statement of a migration, logged with -verbose-sql.
+func execStatement(executor gorp.SqlExecutor, m *migrate.PlannedMigration, stmt string) error {
+	logStatementStarted(m, stmt)
+	start := time.Now()
+	_, err := executor.Exec(stmt)
+	logStatementExecuted(m, stmt, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type ApplySuite struct {
+	migrations []*migrate.Migration
+}
+
+var _ = Suite(&ApplySuite{})
+
+func (s *ApplySuite) SetUpTest(*C) {
+	s.migrations = []*migrate.Migration{
+		{Id: "1_initial.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+		{Id: "2_index.sql", Up: []string{"CREATE INDEX people_id ON people (id)"}, Down: []string{"DROP INDEX people_id"}},
+		{Id: "3_record.sql", Up: []string{"INSERT INTO people (id) VALUES (1)"}, Down: []string{"DELETE FROM people"}},
+	}
+}
+
+func (s *ApplySuite) TestCheckApplyOrderUp(c *C) {
+	applied := map[string]bool{"1_initial.sql": true}
+
+	m, err := checkApplyOrder(s.migrations, applied, "2_index.sql", migrate.Up, false)
+	c.Assert(err, IsNil)
+	c.Assert(m.Queries, DeepEquals, []string{"CREATE INDEX people_id ON people (id)"})
+
+	_, err = checkApplyOrder(s.migrations, applied, "3_record.sql", migrate.Up, false)
+	c.Assert(err, ErrorMatches, `Migration 3_record.sql comes after migrations that are not applied \(2_index.sql\), apply them first or pass -force`)
+
+	_, err = checkApplyOrder(s.migrations, applied, "3_record.sql", migrate.Up, true)
+	c.Assert(err, IsNil)
+
+	_, err = checkApplyOrder(s.migrations, applied, "1_initial.sql", migrate.Up, true)
+	c.Assert(err, ErrorMatches, "Migration 1_initial.sql is already applied")
+}
+
+func (s *ApplySuite) TestCheckApplyOrderDown(c *C) {
+	applied := map[string]bool{"1_initial.sql": true, "2_index.sql": true}
+
+	m, err := checkApplyOrder(s.migrations, applied, "2_index.sql", migrate.Down, false)
+	c.Assert(err, IsNil)
+	c.Assert(m.Queries, DeepEquals, []string{"DROP INDEX people_id"})
+
+	_, err = checkApplyOrder(s.migrations, applied, "1_initial.sql", migrate.Down, false)
+	c.Assert(err, ErrorMatches, `Migration 1_initial.sql comes before migrations that are applied \(2_index.sql\), revert them first or pass -force`)
+
+	_, err = checkApplyOrder(s.migrations, applied, "1_initial.sql", migrate.Down, true)
+	c.Assert(err, IsNil)
+
+	_, err = checkApplyOrder(s.migrations, applied, "3_record.sql", migrate.Down, true)
+	c.Assert(err, ErrorMatches, "Migration 3_record.sql is not applied")
+}
+
+func (s *ApplySuite) TestExecMigration(c *C) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	migrate.SetTable("apply_migrations")
+	migrate.SetSchema("")
+	source := &migrate.MemoryMigrationSource{Migrations: s.migrations}
+	_, dbMap, err := migrate.PlanMigration(db, "sqlite3", source, migrate.Up, 0)
+	c.Assert(err, IsNil)
+
+	m, err := checkApplyOrder(s.migrations, map[string]bool{}, "1_initial.sql", migrate.Up, false)
+	c.Assert(err, IsNil)
+	c.Assert(execMigration(context.Background(), dbMap, m, migrate.Up), IsNil)
+
+	// A failing statement rolls back the whole migration, record included.
+	m, err = checkApplyOrder(s.migrations, map[string]bool{"1_initial.sql": true}, "3_record.sql", migrate.Up, true)
+	c.Assert(err, IsNil)
+	m.Queries = append(m.Queries, "INSERT INTO missing (id) VALUES (1)")
+	c.Assert(execMigration(context.Background(), dbMap, m, migrate.Up), ErrorMatches, ".*no such table: missing.*")
+
+	var count int
+	c.Assert(db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count), IsNil)
+	c.Assert(count, Equals, 0)
+
+	records, err := migrate.GetMigrationRecords(db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Id, Equals, "1_initial.sql")
+}
+
+func (*ConfigSuite) TestApplyMigration(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+  table: apply_migrations
+`)
+	ctx := context.Background()
+
+	c.Assert(ApplyMigration(ctx, "2", migrate.Up, false, false), ErrorMatches, "Migration 2_record.sql comes after migrations that are not applied .*")
+	c.Assert(ApplyMigration(ctx, "1", migrate.Up, false, false), IsNil)
+	c.Assert(ApplyMigration(ctx, "2_record", migrate.Up, false, false), IsNil)
+	c.Assert(ApplyMigration(ctx, "1", migrate.Down, false, false), ErrorMatches, "Migration 1_initial.sql comes before migrations that are applied .*")
+	c.Assert(ApplyMigration(ctx, "2", migrate.Down, false, false), IsNil)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, dialect, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	applied, err := appliedMigrationIds(db, dialect, env)
+	c.Assert(err, IsNil)
+	c.Assert(applied, DeepEquals, map[string]bool{"1_initial.sql": true})
+}
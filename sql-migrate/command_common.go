@@ -1,74 +1,496 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
 
-func ApplyMigrations(dir migrate.MigrationDirection, dryrun bool, limit int, version int64) error {
+// OutFile receives the statements of a dry run instead of the output, set
+// with -out.
+var OutFile string
+
+// RollbackCount is the number of migrations to roll back with -count, more
+// than are applied is refused. RollbackAll rolls back all of them.
+var (
+	RollbackCount int
+	RollbackAll   bool
+)
+
+// ApplyMigrations migrates the database in the given direction and returns
+// the number of migrations applied, or that would be with dryrun. The
+// databases of an environment with shards are migrated one after the other,
+// or -parallel at a time, and so are the environments when -env lists
+// several.
+func ApplyMigrations(ctx context.Context, dir migrate.MigrationDirection, dryrun bool, limit int, version int64, target string) (int, error) {
+	if !hasEnvironmentFlags() && strings.Contains(ConfigEnvironment, ",") {
+		names, err := environmentNames(ConfigEnvironment)
+		if err != nil {
+			return 0, err
+		}
+		return applyEnvironmentMigrations(ctx, names, dir, dryrun, limit, version, target)
+	}
+	return applyEnvironment(ctx, dir, dryrun, limit, version, target)
+}
+
+// applyEnvironment migrates the environment selected with -env.
+func applyEnvironment(ctx context.Context, dir migrate.MigrationDirection, dryrun bool, limit int, version int64, target string) (int, error) {
 	env, err := GetEnvironment()
 	if err != nil {
-		return fmt.Errorf("Could not parse config: %w", err)
+		return 0, fmt.Errorf("Could not parse config: %w", err)
+	}
+	if CreateDatabase && env.Production {
+		return 0, fmt.Errorf("-create-db cannot be used with the production environment %s", ConfigEnvironment)
+	}
+	if SingleTransaction {
+		if err := checkSingleTransactionDialect(env); err != nil {
+			return 0, err
+		}
 	}
 
-	db, dialect, err := GetConnection(env)
+	// -print-dsn prints all the shards at once.
+	if len(env.Shards) > 0 && !PrintDataSource {
+		return applyShardMigrations(ctx, env, dir, dryrun, limit, version, target)
+	}
+	return applyMigrations(ctx, env, dir, dryrun, limit, version, target)
+}
+
+// applyMigrations migrates the database of the environment.
+func applyMigrations(ctx context.Context, env *Environment, dir migrate.MigrationDirection, dryrun bool, limit int, version int64, target string) (int, error) {
+	if CreateDatabase && !dryrun && !PrintDataSource {
+		if err := createDatabase(ctx, env); err != nil {
+			if interrupted(ctx) {
+				return 0, interruptedError(ctx, err, dir, 0)
+			}
+			return 0, err
+		}
+	}
+
+	var hooks *hookSet
+	if !dryrun {
+		var err error
+		if hooks, err = loadHookSet(env); err != nil {
+			return 0, err
+		}
+	}
+
+	db, dialect, err := GetConnectionContext(ctx, env)
 	if err != nil {
-		return err
+		if interrupted(ctx) {
+			return 0, interruptedError(ctx, err, dir, 0)
+		}
+		return 0, err
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	if !dryrun {
+		hooks.pinConnection(db)
+		unlock, err := lockMigrations(ctx, db, env)
+		if err != nil {
+			if interrupted(ctx) {
+				return 0, interruptedError(ctx, err, dir, 0)
+			}
+			return 0, err
+		}
+		defer unlock()
 	}
 
-	if dryrun {
-		var migrations []*migrate.PlannedMigration
+	source := migrationSource(env)
 
-		if version >= 0 {
-			migrations, _, err = migrate.PlanMigrationToVersion(db, dialect, source, dir, version)
-		} else {
-			migrations, _, err = migrate.PlanMigration(db, dialect, source, dir, limit)
+	if target != "" {
+		limit, err = limitToTarget(db, dialect, env, source, dir, target)
+		if err != nil {
+			return 0, err
 		}
+		if limit == 0 {
+			if dryrun && OutFile != "" {
+				return 0, writeMigrations(OutFile, nil, dir)
+			}
+			ui.Output(fmt.Sprintf("Nothing to do, migration %s is already applied", target))
+			return 0, nil
+		}
+		version = -1
+	}
 
+	rollback := "Roll back migrations"
+	if dir == migrate.Down && (RollbackCount > 0 || RollbackAll) {
+		applied, err := PlanMigrations(db, dialect, env, source, migrate.Down, 0, -1)
 		if err != nil {
-			return fmt.Errorf("Cannot plan migration: %w", err)
+			return 0, fmt.Errorf("Cannot plan migration: %w", err)
+		}
+		if err := checkRollbackCount(RollbackCount, len(applied)); err != nil {
+			return 0, err
 		}
+		limit, version = RollbackCount, -1
+		if RollbackAll {
+			limit = 0
+			rollback = fmt.Sprintf("Roll back all %d migrations", len(applied))
+		}
+	}
 
+	if dryrun {
+		migrations, err := PlanMigrations(db, dialect, env, source, dir, limit, version)
+		if err != nil {
+			return 0, fmt.Errorf("Cannot plan migration: %w", err)
+		}
+
+		if OutFile != "" {
+			return len(migrations), writeMigrations(OutFile, migrations, dir)
+		}
 		for _, m := range migrations {
 			PrintMigration(m, dir)
 		}
-	} else {
-		var n int
+		return len(migrations), nil
+	}
+
+	if dir == migrate.Down {
+		if err := confirmProduction(env, rollback); err != nil {
+			return 0, err
+		}
+	} else if env.ConfirmUp {
+		if err := confirmProduction(env, "Apply migrations"); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := createSchemas(ctx, db, env); err != nil {
+		return 0, err
+	}
+
+	audit, err := openAuditLog(db, env)
+	if err != nil {
+		return 0, err
+	}
 
+	var n int
+
+	run := newRunMetrics(directionName(dir))
+	// A migration set of its own rather than the global one, shards are
+	// migrated concurrently with -parallel.
+	migrationSet := environmentMigrationSet(env)
+	migrationSet.MigrationApplied = audit.wrap(run.applied)
+	migrationSet.StatementStarted = logStatementStarted
+	migrationSet.StatementExecuted = logStatementExecuted
+
+	if err := hooks.runBefore(ctx, db); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	n, err = execWithRetry(ctx, env.Retries, retryBackoffOf(env, retryBackoff), dir, func(applied int) (int, error) {
+		if SingleTransaction {
+			return execSingleTransaction(ctx, db, dialect, migrationSet, source, dir, limit, version)
+		}
 		if version >= 0 {
-			n, err = migrate.ExecVersion(db, dialect, source, dir, version)
-		} else {
-			n, err = migrate.ExecMax(db, dialect, source, dir, limit)
+			return migrationSet.ExecVersionContext(ctx, db, dialect, source, dir, version)
 		}
+		if limit > 0 {
+			return migrationSet.ExecMaxContext(ctx, db, dialect, source, dir, limit-applied)
+		}
+		return migrationSet.ExecMaxContext(ctx, db, dialect, source, dir, limit)
+	})
 
-		if err != nil {
-			return fmt.Errorf("Migration failed: %w", err)
+	// The after hooks run even when a migration failed, to undo what the
+	// before hooks did.
+	hookErr := hooks.runAfter(ctx, db)
+	if hookErr != nil && err != nil {
+		ui.Warn(hookErr.Error())
+	}
+
+	if err != nil {
+		run.failed(dir, err)
+	}
+	if err := run.write(err == nil); err != nil {
+		ui.Warn(fmt.Sprintf("Cannot write metrics: %s", err))
+	}
+
+	if err != nil {
+		if interrupted(ctx) {
+			return n, interruptedError(ctx, err, dir, n)
+		}
+		var txErr *migrate.TxError
+		if SingleTransaction && errors.As(err, &txErr) {
+			return n, fmt.Errorf("Migration failed, all the migrations were rolled back (-single-transaction): %w", err)
+		}
+		return n, fmt.Errorf("Migration failed: %w", err)
+	}
+	logger().Info("migrations applied", "count", n, "duration", time.Since(start))
+
+	if err := syncChecksums(db, dialect, env, source); err != nil {
+		return n, err
+	}
+
+	if n == 1 {
+		ui.Output(colorApplied.Sprint("Applied 1 migration"))
+	} else {
+		ui.Output(colorApplied.Sprintf("Applied %d migrations", n))
+	}
+
+	if hookErr != nil {
+		return n, fmt.Errorf("%w, the migrations applied are kept", hookErr)
+	}
+	return n, nil
+}
+
+// checkRollbackCount refuses to roll back more migrations than are applied,
+// instead of silently rolling back fewer.
+func checkRollbackCount(count, applied int) error {
+	if count <= applied {
+		return nil
+	}
+	migrations := "migrations"
+	if count == 1 {
+		migrations = "migration"
+	}
+	switch applied {
+	case 0:
+		return fmt.Errorf("Cannot roll back %d %s, none are applied", count, migrations)
+	case 1:
+		return fmt.Errorf("Cannot roll back %d %s, only 1 is applied", count, migrations)
+	default:
+		return fmt.Errorf("Cannot roll back %d %s, only %d are applied", count, migrations, applied)
+	}
+}
+
+// limitToTarget returns the number of migrations to apply in the given
+// direction to end up at the target migration: when migrating up, the
+// pending migrations up to and including it are applied, when migrating
+// down, the migrations applied after it are reverted and the target stays
+// applied.
+func limitToTarget(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource, dir migrate.MigrationDirection, target string) (int, error) {
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := findMigrationId(migrations, target)
+	if err != nil {
+		return 0, err
+	}
+
+	planned, err := PlanMigrations(db, dialect, env, source, dir, 0, -1)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot plan migration: %w", err)
+	}
+
+	for i, m := range planned {
+		if m.Id == id {
+			if dir == migrate.Up {
+				return i + 1, nil
+			}
+			return i, nil
 		}
+	}
 
-		if n == 1 {
-			ui.Output("Applied 1 migration")
-		} else {
-			ui.Output(fmt.Sprintf("Applied %d migrations", n))
+	if dir == migrate.Up {
+		// Not pending, so already applied: there is nothing left to do.
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("Migration %s is not applied", id)
+}
+
+// findMigrationId resolves a migration given by its full id, its id without
+// the .sql extension or its numeric prefix (0005 matches 5_add_users.sql).
+func findMigrationId(migrations []*migrate.Migration, target string) (string, error) {
+	for _, m := range migrations {
+		if m.Id == target || strings.TrimSuffix(m.Id, ".sql") == target {
+			return m.Id, nil
 		}
 	}
 
+	version, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("Unknown migration %s", target)
+	}
+
+	var found []string
+	for _, m := range migrations {
+		if len(m.NumberPrefixMatches()) > 0 && m.VersionInt() == version {
+			found = append(found, m.Id)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("Unknown migration %s", target)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("Migration %s is ambiguous, it matches %s", target, strings.Join(found, ", "))
+	}
+}
+
+// PlanMigrations plans the migrations without writing anything to the
+// database. Unlike migrate.PlanMigration, the migration table is not created
+// when it doesn't exist yet: all migrations are pending in that case.
+func PlanMigrations(db *sql.DB, dialect string, env *Environment, source migrate.MigrationSource, dir migrate.MigrationDirection, limit int, version int64) ([]*migrate.PlannedMigration, error) {
+	if !migrationTableExists(db, env) {
+		return planPending(source, dir, limit, version)
+	}
+
+	migrationSet := environmentMigrationSet(env)
+	migrationSet.DisableCreateTable = true
+
+	var migrations []*migrate.PlannedMigration
+	var err error
+	if version >= 0 {
+		migrations, _, err = migrationSet.PlanMigrationToVersion(db, dialect, source, dir, version)
+	} else {
+		migrations, _, err = migrationSet.PlanMigration(db, dialect, source, dir, limit)
+	}
+	return migrations, err
+}
+
+// environmentMigrationSet returns the migration set of the environment. It
+// is used instead of the global one, which keeps the table and schema of
+// the environments selected before.
+func environmentMigrationSet(env *Environment) migrate.MigrationSet {
+	return migrate.MigrationSet{
+		TableName:          env.TableName,
+		SchemaName:         env.SchemaName,
+		IgnoreUnknown:      env.IgnoreUnknown,
+		Ordering:           migrationOrdering(env),
+		DisableCreateTable: env.DisableCreateTable,
+		Dialect:            environmentDialect(env),
+	}
+}
+
+// migrationTableName returns the name of the migration table, like the
+// migrate package resolves it.
+func migrationTableName(env *Environment) string {
+	if env.TableName == "" {
+		return "gorp_migrations"
+	}
+	return env.TableName
+}
+
+// qualifiedMigrationTableName returns the schema-qualified name of the
+// migration table, for display.
+func qualifiedMigrationTableName(env *Environment) string {
+	if env.SchemaName == "" {
+		return migrationTableName(env)
+	}
+	return env.SchemaName + "." + migrationTableName(env)
+}
+
+func migrationTableExists(db *sql.DB, env *Environment) bool {
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE 1 = 0", environmentDialect(env).QuotedTableForQuery(env.SchemaName, migrationTableName(env)))
+	rows, err := db.Query(query)
+	if err != nil {
+		return false
+	}
+	_ = rows.Close()
+	return true
+}
+
+// createSchemas creates the missing schemas of the environment when
+// createschema is set: the one of the migration table, followed by the ones
+// of the search_path.
+func createSchemas(ctx context.Context, db *sql.DB, env *Environment) error {
+	if !env.CreateSchema {
+		return nil
+	}
+
+	for _, schema := range environmentSchemas(env) {
+		created, err := CreatePostgresSchema(ctx, db, schema)
+		if err != nil {
+			return err
+		}
+		if created {
+			ui.Output(fmt.Sprintf("Created schema %s", schema))
+		}
+	}
 	return nil
 }
 
+// environmentSchemas lists the schemas used by the environment, without
+// duplicates.
+func environmentSchemas(env *Environment) []string {
+	var schemas []string
+	seen := make(map[string]bool)
+	add := func(schema string) {
+		schema = strings.TrimSpace(schema)
+		if schema == "" || schema == "$user" || schema == `"$user"` || seen[schema] {
+			return
+		}
+		seen[schema] = true
+		schemas = append(schemas, schema)
+	}
+
+	add(env.SchemaName)
+	if env.SearchPath != "" {
+		for _, schema := range strings.Split(env.SearchPath, ",") {
+			add(schema)
+		}
+	}
+	return schemas
+}
+
+// planPending plans the migrations of a database which has none applied.
+func planPending(source migrate.MigrationSource, dir migrate.MigrationDirection, limit int, version int64) ([]*migrate.PlannedMigration, error) {
+	if dir == migrate.Down {
+		return nil, nil
+	}
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(migrations)
+	if version >= 0 {
+		count = -1
+		for i, m := range migrations {
+			if len(m.NumberPrefixMatches()) > 0 && m.VersionInt() == version {
+				count = i + 1
+				break
+			}
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("unknown migration with version id %d", version)
+		}
+	} else if limit > 0 && limit < count {
+		count = limit
+	}
+
+	planned := make([]*migrate.PlannedMigration, 0, count)
+	for _, m := range migrations[:count] {
+		planned = append(planned, &migrate.PlannedMigration{
+			Migration:          m,
+			Queries:            m.Up,
+			DisableTransaction: m.DisableTransactionUp,
+		})
+	}
+	return planned, nil
+}
+
+// trimStatement removes the trailing semicolon of a statement like the
+// migrate package does before running it, Oracle rejects it.
+func trimStatement(stmt string) string {
+	stmt = strings.TrimSuffix(stmt, "\n")
+	stmt = strings.TrimSuffix(stmt, " ")
+	return strings.TrimSuffix(stmt, ";")
+}
+
+// PrintMigration prints the statements of a migration in the given
+// direction, noting when they run outside of a transaction because of the
+// notransaction option.
 func PrintMigration(m *migrate.PlannedMigration, dir migrate.MigrationDirection) {
 	if dir == migrate.Up {
-		ui.Output(fmt.Sprintf("==> Would apply migration %s (up)", m.Id))
+		ui.Output(fmt.Sprintf("==> Would apply migration %s (up%s)", m.Id, transactionNote(m.DisableTransactionUp)))
 		for _, q := range m.Up {
 			ui.Output(q)
 		}
 	} else if dir == migrate.Down {
-		ui.Output(fmt.Sprintf("==> Would apply migration %s (down)", m.Id))
+		ui.Output(fmt.Sprintf("==> Would apply migration %s (down%s)", m.Id, transactionNote(m.DisableTransactionDown)))
 		for _, q := range m.Down {
 			ui.Output(q)
 		}
@@ -76,3 +498,48 @@ func PrintMigration(m *migrate.PlannedMigration, dir migrate.MigrationDirection)
 		panic("Not reached")
 	}
 }
+
+// writeMigrations writes the statements of the planned migrations to a
+// file, for review, each migration introduced by a comment with its id.
+func writeMigrations(name string, migrations []*migrate.PlannedMigration, dir migrate.MigrationDirection) error {
+	if err := os.WriteFile(name, []byte(formatMigrations(migrations, dir)), 0o644); err != nil {
+		return err
+	}
+	if len(migrations) == 1 {
+		ui.Output(fmt.Sprintf("Wrote 1 migration to %s", name))
+	} else {
+		ui.Output(fmt.Sprintf("Wrote %d migrations to %s", len(migrations), name))
+	}
+	return nil
+}
+
+// formatMigrations lays out the statements of the planned migrations as a
+// SQL script, which only depends on the migrations.
+func formatMigrations(migrations []*migrate.PlannedMigration, dir migrate.MigrationDirection) string {
+	if len(migrations) == 0 {
+		return "-- No pending migrations\n"
+	}
+
+	var b strings.Builder
+	for i, m := range migrations {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		queries, disabled := m.Up, m.DisableTransactionUp
+		if dir == migrate.Down {
+			queries, disabled = m.Down, m.DisableTransactionDown
+		}
+		fmt.Fprintf(&b, "-- Migration %s (%s%s)\n", m.Id, directionName(dir), transactionNote(disabled))
+		for _, q := range queries {
+			b.WriteString(strings.TrimRight(q, "\n") + "\n")
+		}
+	}
+	return b.String()
+}
+
+func transactionNote(disabled bool) string {
+	if disabled {
+		return ", without a transaction"
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type CommandSuite struct {
+	db  *sql.DB
+	env *Environment
+}
+
+var _ = Suite(&CommandSuite{})
+
+func (s *CommandSuite) SetUpTest(c *C) {
+	var err error
+	s.db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+	s.db.SetMaxOpenConns(1)
+
+	s.env = &Environment{Dialect: "sqlite3", Dir: "../test-migrations", TableName: "dryrun_migrations"}
+}
+
+func (s *CommandSuite) TearDownTest(c *C) {
+	c.Assert(s.db.Close(), IsNil)
+}
+
+func (s *CommandSuite) source() migrate.MigrationSource {
+	return migrate.FileMigrationSource{Dir: s.env.Dir}
+}
+
+func (s *CommandSuite) TestPlanMigrationsWithoutTable(c *C) {
+	migrations, err := PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Up, 0, -1)
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 2)
+	c.Assert(migrations[0].Id, Equals, "1_initial.sql")
+
+	migrations, err = PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Up, 0, 1)
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+
+	migrations, err = PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Down, 1, -1)
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 0)
+
+	// Planning must not have created the migration table.
+	c.Assert(migrationTableExists(s.db, s.env), Equals, false)
+}
+
+func (s *CommandSuite) TestPlanMigrationsWithTable(c *C) {
+	migrationSet := migrate.MigrationSet{TableName: s.env.TableName}
+	n, err := migrationSet.ExecMax(s.db, "sqlite3", s.source(), migrate.Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	migrations, err := PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Up, 0, -1)
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Id, Equals, "2_record.sql")
+
+	migrations, err = PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Down, 1, -1)
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Id, Equals, "1_initial.sql")
+}
+
+func (s *CommandSuite) TestQualifiedMigrationTableName(c *C) {
+	c.Assert(qualifiedMigrationTableName(&Environment{}), Equals, "gorp_migrations")
+	c.Assert(qualifiedMigrationTableName(s.env), Equals, "dryrun_migrations")
+	c.Assert(qualifiedMigrationTableName(&Environment{SchemaName: "tenant"}), Equals, "tenant.gorp_migrations")
+}
+
+func (s *CommandSuite) TestLimitToTargetDown(c *C) {
+	migrationSet := migrate.MigrationSet{TableName: s.env.TableName}
+	_, err := migrationSet.Exec(s.db, "sqlite3", s.source(), migrate.Up)
+	c.Assert(err, IsNil)
+
+	limit, err := limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Down, "1")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 1)
+
+	limit, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Down, "2_record")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 0)
+
+	_, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Down, "3")
+	c.Assert(err, ErrorMatches, "Unknown migration 3")
+
+	_, err = migrationSet.ExecMax(s.db, "sqlite3", s.source(), migrate.Down, 1)
+	c.Assert(err, IsNil)
+	_, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Down, "2_record.sql")
+	c.Assert(err, ErrorMatches, "Migration 2_record.sql is not applied")
+}
+
+func (s *CommandSuite) TestLimitToTargetUp(c *C) {
+	limit, err := limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Up, "1_initial.sql")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 1)
+
+	limit, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Up, "2")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 2)
+
+	migrationSet := migrate.MigrationSet{TableName: s.env.TableName}
+	_, err = migrationSet.ExecMax(s.db, "sqlite3", s.source(), migrate.Up, 1)
+	c.Assert(err, IsNil)
+
+	limit, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Up, "2")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 1)
+
+	// Already applied, nothing left to do.
+	limit, err = limitToTarget(s.db, "sqlite3", s.env, s.source(), migrate.Up, "1")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, 0)
+}
+
+func (*CommandSuite) TestEnvironmentSchemas(c *C) {
+	env := &Environment{SchemaName: "migrations", SearchPath: "tenant, $user, migrations, public"}
+	c.Assert(environmentSchemas(env), DeepEquals, []string{"migrations", "tenant", "public"})
+	c.Assert(environmentSchemas(&Environment{}), HasLen, 0)
+}
+
+func (*CommandSuite) TestFindMigrationId(c *C) {
+	migrations := []*migrate.Migration{{Id: "0005_users.sql"}, {Id: "5_other.sql"}, {Id: "0006_posts.sql"}}
+
+	id, err := findMigrationId(migrations, "0006")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, "0006_posts.sql")
+
+	id, err = findMigrationId(migrations, "0005_users")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, "0005_users.sql")
+
+	_, err = findMigrationId(migrations, "5")
+	c.Assert(err, ErrorMatches, "Migration 5 is ambiguous, it matches 0005_users.sql, 5_other.sql")
+}
+
+func (*CommandSuite) TestPrintMigrationWithoutTransaction(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	migration, err := migrate.ParseMigration("1_index.sql", strings.NewReader(`
+-- +migrate Up notransaction
+CREATE INDEX CONCURRENTLY people_id_idx ON people (id);
+
+-- +migrate Down
+DROP INDEX people_id_idx;
+`))
+	c.Assert(err, IsNil)
+
+	planned := &migrate.PlannedMigration{Migration: migration, Queries: migration.Up, DisableTransaction: true}
+	PrintMigration(planned, migrate.Up)
+	PrintMigration(planned, migrate.Down)
+	out := mock.OutputWriter.String()
+	c.Assert(strings.Contains(out, "==> Would apply migration 1_index.sql (up, without a transaction)\n"), Equals, true)
+	c.Assert(strings.Contains(out, "==> Would apply migration 1_index.sql (down)\n"), Equals, true)
+}
+
+func (s *CommandSuite) TestFormatMigrations(c *C) {
+	migrations, err := PlanMigrations(s.db, "sqlite3", s.env, s.source(), migrate.Up, 0, -1)
+	c.Assert(err, IsNil)
+
+	c.Assert(formatMigrations(migrations, migrate.Up), Equals, `-- Migration 1_initial.sql (up)
+CREATE TABLE people (id int);
+
+-- Migration 2_record.sql (up)
+INSERT INTO people (id) VALUES (1);
+`)
+	c.Assert(formatMigrations(nil, migrate.Up), Equals, "-- No pending migrations\n")
+}
+
+func (*ConfigSuite) TestApplyMigrationsOut(c *C) {
+	dir := c.MkDir()
+	db := filepath.Join(dir, "test.db")
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+db+`
+  dir: ../test-migrations
+  table: out_migrations
+`)
+	OutFile = filepath.Join(dir, "migration.sql")
+	defer func() { OutFile = "" }()
+
+	n, err := ApplyMigrations(context.Background(), migrate.Up, true, 0, -1, "1")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	out, err := os.ReadFile(OutFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Matches, `-- Migration 1_initial.sql \(up\)\n(?s).*CREATE TABLE people \(id int\);\n`)
+
+	// Nothing was written to the database.
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	conn, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	c.Assert(migrationTableExists(conn, env), Equals, false)
+}
+
+func (*ConfigSuite) TestApplyMigrationsRollbackCount(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+  table: count_migrations
+`)
+	defer func() { RollbackCount, RollbackAll = 0, false }()
+	ctx := context.Background()
+
+	RollbackCount = 1
+	_, err := ApplyMigrations(ctx, migrate.Down, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "Cannot roll back 1 migration, none are applied")
+
+	n, err := ApplyMigrations(ctx, migrate.Up, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	RollbackCount = 3
+	_, err = ApplyMigrations(ctx, migrate.Down, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "Cannot roll back 3 migrations, only 2 are applied")
+	RollbackCount = 1
+	n, err = ApplyMigrations(ctx, migrate.Down, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	RollbackCount, RollbackAll = 0, true
+	n, err = ApplyMigrations(ctx, migrate.Down, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, dialect, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	applied, err := appliedMigrationIds(db, dialect, env)
+	c.Assert(err, IsNil)
+	c.Assert(applied, HasLen, 0)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// exitEnvironmentsDiffer is the exit code of diff when the environments
+// don't have the same migrations applied.
+const exitEnvironmentsDiffer = 2
+
+type DiffCommand struct{}
+
+func (*DiffCommand) Help() string {
+	helpText := `
+Usage: sql-migrate diff [options] <env-a> <env-b>
+
+  Compare the migrations applied to two environments of the configuration
+  file, and list the ones applied to only one of them, in the order they were
+  applied. Exits with 2 when they differ, 0 when they don't and 1 on errors.
+  Nothing is written to the databases.
+
+Options:
+
+`
+	return optionsHelp(helpText, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp)
+}
+
+func (*DiffCommand) Synopsis() string {
+	return "Compare the migrations applied to two environments"
+}
+
+func (c *DiffCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	names := cmdFlags.Args()
+	if len(names) != 2 {
+		ui.Error("Give the two environments to compare")
+		return 1
+	}
+	if names[0] == names[1] {
+		ui.Error(fmt.Sprintf("Give two different environments, not %s twice", names[0]))
+		return 1
+	}
+	if hasEnvironmentFlags() {
+		ui.Error("diff compares environments of the configuration file, -dialect and -datasource cannot be used")
+		return 1
+	}
+
+	// With -print-dsn, both data sources are printed.
+	a, err := environmentRecords(names[0])
+	if err != nil && !errors.Is(err, errPrintedDataSource) {
+		ui.Error(err.Error())
+		return 1
+	}
+	b, err := environmentRecords(names[1])
+	if err != nil && !errors.Is(err, errPrintedDataSource) {
+		ui.Error(err.Error())
+		return 1
+	}
+	if PrintDataSource {
+		return 0
+	}
+
+	onlyA, onlyB := diffRecords(a, b), diffRecords(b, a)
+	if len(onlyA) == 0 && len(onlyB) == 0 {
+		ui.Output(fmt.Sprintf("%s and %s have the same %d migrations applied", names[0], names[1], len(a)))
+		return 0
+	}
+	for i, only := range [][]*migrate.MigrationRecord{onlyA, onlyB} {
+		if len(only) == 0 {
+			continue
+		}
+		ui.Output(fmt.Sprintf("Applied to %s only:", names[i]))
+		for _, r := range only {
+			ui.Output("  " + r.Id)
+		}
+	}
+	return exitEnvironmentsDiffer
+}
+
+// environmentRecords returns the applied migrations of the named
+// environment, none when its migration table doesn't exist yet. The data
+// source is masked in the errors, which name the environment.
+func environmentRecords(name string) ([]*migrate.MigrationRecord, error) {
+	env, err := getEnvironment(name)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse config of %s: %w", name, err)
+	}
+	fail := func(err error) error {
+		return fmt.Errorf("Environment %s: %w", name, maskError(err, env.DataSource))
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return nil, fail(err)
+	}
+	defer db.Close()
+
+	if !migrationTableExists(db, env) {
+		return nil, nil
+	}
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return records, nil
+}
+
+// diffRecords returns the records of a whose migration is not in b, in the
+// order they were applied.
+func diffRecords(a, b []*migrate.MigrationRecord) []*migrate.MigrationRecord {
+	inB := make(map[string]bool, len(b))
+	for _, r := range b {
+		inB[r.Id] = true
+	}
+
+	var only []*migrate.MigrationRecord
+	for _, r := range a {
+		if !inB[r.Id] {
+			only = append(only, r)
+		}
+	}
+	sort.SliceStable(only, func(i, j int) bool {
+		return only[i].AppliedAt.Before(only[j].AppliedAt)
+	})
+	return only
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type DoctorCommand struct{}
+
+func (*DoctorCommand) Help() string {
+	helpText := `
+Usage: sql-migrate doctor [options] ...
+
+  Summarize the configuration and the state of the database of an
+  environment, for troubleshooting and bug reports. Every check is run
+  even when an earlier one fails, as far as possible.
+
+  Exits with 1 when a check failed. Connecting is not retried, unless
+  -connect-retries is given.
+
+Options:
+
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp)
+}
+
+func (*DoctorCommand) Synopsis() string {
+	return "Summarize the configuration and database of an environment"
+}
+
+func (c *DoctorCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	// An unreachable database is one of the things being diagnosed, don't
+	// wait for it unless asked to.
+	if !isFlagSet(cmdFlags, "connect-retries") {
+		_ = cmdFlags.Set("connect-retries", "0")
+	}
+
+	d := &doctor{}
+	d.run()
+	if d.failed {
+		return 1
+	}
+	return 0
+}
+
+// doctor prints a line per check, noting whether any failed.
+type doctor struct {
+	failed bool
+}
+
+func (d *doctor) report(name, value string) {
+	ui.Output(fmt.Sprintf("%-16s%s", name, value))
+}
+
+func (d *doctor) fail(name string, err error) {
+	d.failed = true
+	ui.Output(fmt.Sprintf("%-16sERROR: %s", name, err))
+}
+
+func (d *doctor) run() {
+	d.report("Version", GetVersion())
+
+	if hasEnvironmentFlags() {
+		d.report("Config file", "none, using -dialect and -datasource")
+	} else {
+		var files []string
+		for _, name := range strings.Split(ConfigFile, ",") {
+			if strings.TrimSpace(name) == "-" {
+				name = "stdin"
+			} else if isConfigURL(strings.TrimSpace(name)) {
+				name = configURLLabel(strings.TrimSpace(name))
+			} else if abs, err := filepath.Abs(strings.TrimSpace(name)); err == nil {
+				name = abs
+			}
+			files = append(files, name)
+		}
+		d.report("Config file", strings.Join(files, ", "))
+
+		config, err := ReadConfig()
+		if err != nil {
+			d.fail("Environments", err)
+		} else {
+			names := make([]string, 0, len(config))
+			for name := range config {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			d.report("Environments", strings.Join(names, ", "))
+		}
+	}
+
+	d.report("Environment", ConfigEnvironment)
+	env, err := GetEnvironment()
+	if err != nil {
+		d.fail("Configuration", err)
+		return
+	}
+
+	d.report("Dialect", env.Dialect)
+	d.report("Data source", describeDataSource(env))
+	d.report("Table", qualifiedMigrationTableName(env))
+
+	dirs := env.Dirs
+	if env.RemoteDir != "" {
+		dirs = []string{env.RemoteDir}
+	} else if len(dirs) == 0 {
+		dirs = []string{env.Dir}
+	}
+	d.report("Source", fmt.Sprintf("%s, %s", env.Source, strings.Join(dirs, ", ")))
+
+	source := migrationSource(env)
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		d.fail("Migrations", err)
+	} else {
+		d.report("Migrations", fmt.Sprintf("%d files", len(migrations)))
+	}
+
+	start := time.Now()
+	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		d.report("Database", "not connected with -print-dsn")
+		return
+	}
+	if err != nil {
+		d.fail("Database", err)
+		return
+	}
+	defer db.Close()
+	d.report("Database", fmt.Sprintf("reachable (%s)", time.Since(start).Round(time.Millisecond)))
+
+	if !migrationTableExists(db, env) {
+		d.report("Applied", "none, the migration table does not exist yet")
+		return
+	}
+
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+	if err != nil {
+		d.fail("Applied", err)
+		return
+	}
+	if migrations == nil {
+		d.report("Applied", fmt.Sprintf("%d migrations", len(records)))
+		return
+	}
+
+	pending, err := PlanMigrations(db, dialect, env, source, migrate.Up, 0, -1)
+	if err != nil {
+		d.report("Applied", fmt.Sprintf("%d migrations", len(records)))
+		d.fail("Pending", err)
+		return
+	}
+	d.report("Applied", fmt.Sprintf("%d migrations, %d pending", len(records), len(pending)))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestDoctor(c *C) {
+	defer func(old cli.Ui) { ui = old }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	db := filepath.Join(c.MkDir(), "test.db")
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+db+`
+  dir: ../test-migrations
+  table: doctor_migrations
+broken:
+  dialect: sqlite3
+`)
+
+	d := &doctor{}
+	d.run()
+	c.Assert(d.failed, Equals, false)
+	out := mock.OutputWriter.String()
+	c.Assert(out, Matches, `(?s).*Environments    broken, development\n.*`)
+	c.Assert(out, Matches, `(?s).*Migrations      2 files\n.*`)
+	c.Assert(out, Matches, `(?s).*Database        reachable .*`)
+	c.Assert(out, Matches, `(?s).*Applied         none, the migration table does not exist yet\n`)
+
+	mock.OutputWriter.Reset()
+	ConfigEnvironment = "broken"
+	d = &doctor{}
+	d.run()
+	c.Assert(d.failed, Equals, true)
+	c.Assert(mock.OutputWriter.String(), Matches, `(?s).*Configuration   ERROR: No data source specified\n`)
+}
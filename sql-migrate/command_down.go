@@ -1,8 +1,9 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"strings"
+	"time"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -15,16 +16,42 @@ Usage: sql-migrate down [options] ...
 
   Undo a database migration.
 
+  Several environments can be given to -env, separated by commas.
+
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
-  -limit=1               Limit the number of migrations (0 = unlimited).
+  -count=N               Number of migrations to roll back, refused when fewer are
+                         applied. Without it, the last migration, if any.
+  -all                   Roll back all the applied migrations.
+  -limit=1               Limit the number of migrations (0 = unlimited), rolling
+                         back fewer when fewer are applied.
   -version               Run migrate down to a specific version, eg: the version number of migration 1_initial.sql is 1.
-  -dryrun                Don't apply migrations, just print them.
-
+  -to=id                 Revert the migrations applied after this one, which stays
+                         applied. Takes the id, with or without .sql, or its number.
+  -dryrun, -dry-run      Don't apply migrations, just print them.
+  -metrics-file=path     Write the duration of the migrations to this file, in the
+                         Prometheus text format.
+  -statement-timeout=0   Abort statements running longer than this duration, such
+                         as 30s, on Postgres and MySQL (0 = no limit). MySQL only
+                         limits SELECT statements, not DDL.
+  -verbose-sql           Log each statement before it runs, and its duration
+                         after it, even without -v.
+  -wait=0                Keep trying to reach the database for up to this long,
+                         such as 1m, instead of -connect-retries times, for a
+                         database starting along with the migrations.
+  -lock-timeout=5m       Maximum time to wait for another migration run to finish
+                         (0 = no limit).
+  -force-unlock          Break a lock table entry older than the lockttl of the
+                         environment.
+  -single-transaction    Run all the migrations in one transaction, rolled back
+                         entirely when one fails. Refused for MySQL and Oracle,
+                         which commit schema changes implicitly.
+  -parallel=1            Number of shards to migrate at once, for environments
+                         with shards.
+  -continue-on-error     Carry on with the next environments when one of those
+                         listed in -env fails.
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp, promptHelp)
 }
 
 func (*DownCommand) Synopsis() string {
@@ -35,19 +62,75 @@ func (c *DownCommand) Run(args []string) int {
 	var limit int
 	var version int64
 	var dryrun bool
+	var target string
 
 	cmdFlags := flag.NewFlagSet("down", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.IntVar(&RollbackCount, "count", 1, "Number of migrations to roll back.")
+	cmdFlags.BoolVar(&RollbackAll, "all", false, "Roll back all the applied migrations.")
 	cmdFlags.IntVar(&limit, "limit", 1, "Max number of migrations to apply.")
 	cmdFlags.Int64Var(&version, "version", -1, "Migrate down to a specific version.")
+	cmdFlags.StringVar(&target, "to", "", "Revert the migrations applied after this one.")
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	cmdFlags.BoolVar(&dryrun, "dry-run", false, "Alias of -dryrun.")
+	cmdFlags.StringVar(&MetricsFile, "metrics-file", "", "Write the duration of the migrations to this file, in the Prometheus text format.")
+	cmdFlags.DurationVar(&StatementTimeout, "statement-timeout", 0, "Abort statements running longer than this duration (0 = no limit).")
+	cmdFlags.BoolVar(&VerboseSql, "verbose-sql", false, "Log each statement before it runs, and its duration after it.")
+	cmdFlags.DurationVar(&Wait, "wait", 0, "Keep trying to reach the database for up to this long.")
+	cmdFlags.DurationVar(&LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another migration run to finish (0 = no limit).")
+	cmdFlags.BoolVar(&ForceUnlock, "force-unlock", false, "Break a lock table entry older than the lockttl of the environment.")
+	cmdFlags.BoolVar(&SingleTransaction, "single-transaction", false, "Run all the migrations in one transaction.")
+	cmdFlags.IntVar(&ShardParallel, "parallel", 1, "Number of shards to migrate at once.")
+	cmdFlags.BoolVar(&ContinueOnError, "continue-on-error", false, "Carry on with the next environments when one of those listed in -env fails.")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+	promptFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	err := ApplyMigrations(migrate.Down, dryrun, limit, version)
+	given := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	selected := given["limit"] || given["version"] || given["to"]
+	switch {
+	case given["count"] && given["all"]:
+		ui.Error("Give either -count or -all, not both")
+		return 1
+	case selected && (given["count"] || given["all"]):
+		ui.Error("Give either -limit, -version or -to, or -count or -all, not both")
+		return 1
+	case selected:
+		// Without the bound of -count, as before it existed.
+		RollbackCount = 0
+	case RollbackAll:
+		RollbackCount = 0
+	case !given["count"]:
+		// Plain down reverts the last migration, if any, as -limit 1 did
+		// before -count existed.
+		RollbackCount = 0
+	case RollbackCount < 1:
+		ui.Error("-count must be at least 1, use -all to roll back all the migrations")
+		return 1
+	}
+
+	ctx, stop, err := interruptContext()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer stop()
+
+	_, err = ApplyMigrations(ctx, migrate.Down, dryrun, limit, version, target)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
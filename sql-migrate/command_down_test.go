@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestDownCommandCount(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+
+	// Nothing to revert, as before -count existed.
+	c.Assert((&DownCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Applied 0 migrations\n")
+
+	c.Assert((&DownCommand{}).Run([]string{"-config", configFile, "-count", "1"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Cannot roll back 1 migration, none are applied\n")
+
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	mock.OutputWriter.Reset()
+	c.Assert((&DownCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Applied 1 migration\n")
+}
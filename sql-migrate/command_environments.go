@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+type EnvironmentsCommand struct{}
+
+func (*EnvironmentsCommand) Help() string {
+	helpText := `
+Usage: sql-migrate environments [options] ...
+
+  List the environments defined in the configuration file.
+
+Options:
+
+`
+	return optionsHelp(helpText)
+}
+
+func (*EnvironmentsCommand) Synopsis() string {
+	return "List the environments defined in the configuration file"
+}
+
+func (c *EnvironmentsCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("environments", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	config, err := ReadConfig()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tablewriter.NewWriter(outputWriter())
+	table.SetHeader([]string{"Environment", "Dialect", "Datasource"})
+	table.SetColWidth(60)
+
+	for _, name := range names {
+		env := config[name]
+		if env == nil {
+			env = &Environment{}
+		}
+		table.Append([]string{name, env.Dialect, describeDataSource(env)})
+	}
+
+	table.Render()
+
+	return 0
+}
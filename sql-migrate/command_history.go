@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type HistoryCommand struct{}
+
+func (*HistoryCommand) Help() string {
+	helpText := `
+Usage: sql-migrate history [options] ...
+
+  Export the applied migrations recorded in the migration table, in the order
+  they were applied. Nothing is written to the database.
+
+Options:
+
+  -format=csv            Output format, either csv or json.
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp)
+}
+
+func (*HistoryCommand) Synopsis() string {
+	return "Export the applied migrations"
+}
+
+func (c *HistoryCommand) Run(args []string) int {
+	var format string
+
+	cmdFlags := flag.NewFlagSet("history", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&format, "format", "csv", "Output format, either csv or json.")
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if format != "csv" && format != "json" {
+		ui.Error(fmt.Sprintf("Unknown format: %s", format))
+		return 1
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	// A clearer error than the one of the driver, when the table or schema
+	// is mistyped.
+	if !migrationTableExists(db, env) {
+		ui.Error(fmt.Sprintf("Migration table %s does not exist", qualifiedMigrationTableName(env)))
+		return 1
+	}
+
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	out, err := formatHistory(records, format)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	ui.Output(strings.TrimSuffix(out, "\n"))
+
+	return 0
+}
+
+type historyJson struct {
+	Id        string    `json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// formatHistory writes the records as csv or json, sorted by the time they
+// were applied, with the timestamps in UTC.
+func formatHistory(records []*migrate.MigrationRecord, format string) (string, error) {
+	sorted := make([]*migrate.MigrationRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].AppliedAt.Before(sorted[j].AppliedAt)
+	})
+
+	if format == "json" {
+		entries := make([]historyJson, 0, len(sorted))
+		for _, r := range sorted {
+			entries = append(entries, historyJson{Id: r.Id, AppliedAt: r.AppliedAt.UTC()})
+		}
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "applied_at"})
+	for _, r := range sorted {
+		_ = w.Write([]string{r.Id, r.AppliedAt.UTC().Format(time.RFC3339Nano)})
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
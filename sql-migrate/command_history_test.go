@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type HistorySuite struct {
+	records []*migrate.MigrationRecord
+}
+
+var _ = Suite(&HistorySuite{})
+
+func (s *HistorySuite) SetUpTest(*C) {
+	cet := time.FixedZone("CET", 3600)
+	s.records = []*migrate.MigrationRecord{
+		{Id: "1_initial.sql", AppliedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, cet)},
+		{Id: "2_record.sql", AppliedAt: time.Date(2024, 3, 2, 9, 30, 0, 500, time.UTC)},
+		// Applied out of order, with apply.
+		{Id: "10_backfill.sql", AppliedAt: time.Date(2024, 2, 28, 8, 0, 0, 0, time.UTC)},
+		{Id: "3_quote,d.sql", AppliedAt: time.Date(2024, 3, 2, 9, 30, 0, 500, time.UTC)},
+	}
+}
+
+func (s *HistorySuite) TestFormatHistoryCsv(c *C) {
+	out, err := formatHistory(s.records, "csv")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `id,applied_at
+10_backfill.sql,2024-02-28T08:00:00Z
+1_initial.sql,2024-03-01T09:00:00Z
+2_record.sql,2024-03-02T09:30:00.0000005Z
+"3_quote,d.sql",2024-03-02T09:30:00.0000005Z
+`)
+
+	out, err = formatHistory(nil, "csv")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "id,applied_at\n")
+}
+
+func (s *HistorySuite) TestFormatHistoryJson(c *C) {
+	out, err := formatHistory(s.records[:2], "json")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `[
+  {
+    "id": "1_initial.sql",
+    "applied_at": "2024-03-01T09:00:00Z"
+  },
+  {
+    "id": "2_record.sql",
+    "applied_at": "2024-03-02T09:30:00.0000005Z"
+  }
+]`)
+
+	out, err = formatHistory(nil, "json")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "[]")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+var initConfigContent = `# Configuration of sql-migrate, one environment per top-level key. Pick
+# one with -env, development is the default.
+development:
+  # sqlite3, postgres, pgx, mysql, mssql or oracle.
+  dialect: {{.Dialect}}
+  # Environment variables such as ${DB_PASSWORD} are expanded.
+  datasource: {{.DataSource}}
+  # Directory holding the migrations, created by sql-migrate new.
+  dir: {{.Dir}}
+  # Table recording the applied migrations.
+  table: gorp_migrations
+
+# A production environment usually reads its secrets from the environment
+# and asks for confirmation before migrating down:
+#
+# production:
+#   dialect: {{.Dialect}}
+#   datasource: ${DATABASE_URL}
+#   dir: {{.Dir}}
+#   production: true
+`
+var initConfigTpl = template.Must(template.New("init_config").Parse(initConfigContent))
+
+// initDataSources are the data sources written by init for each dialect, to
+// be adapted to the database of the project.
+var initDataSources = map[string]string{
+	"sqlite3":  "development.db",
+	"postgres": "host=localhost dbname=myapp user=myapp password=${DB_PASSWORD} sslmode=disable",
+	"mysql":    "myapp:${DB_PASSWORD}@tcp(localhost:3306)/myapp?parseTime=true",
+}
+
+type InitCommand struct{}
+
+func (*InitCommand) Help() string {
+	helpText := `
+Usage: sql-migrate init [options]
+
+  Write a commented configuration file with a development environment, and
+  create the migrations directory. Existing files are left untouched,
+  unless -force is given.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to write.
+  -dialect=sqlite3       Dialect of the development environment: sqlite3,
+                         postgres or mysql.
+  -dir=migrations        Directory of the migrations.
+  -force                 Overwrite an existing configuration file.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*InitCommand) Synopsis() string {
+	return "Create a configuration file and a migrations directory"
+}
+
+func (c *InitCommand) Run(args []string) int {
+	var configFile, dialect, dir string
+	var force bool
+
+	cmdFlags := flag.NewFlagSet("init", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&configFile, "config", "dbconfig.yml", "Configuration file to write.")
+	cmdFlags.StringVar(&dialect, "dialect", "sqlite3", "Dialect of the development environment.")
+	cmdFlags.StringVar(&dir, "dir", "migrations", "Directory of the migrations.")
+	cmdFlags.BoolVar(&force, "force", false, "Overwrite an existing configuration file.")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if err := initProject(configFile, dialect, dir, force); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	ui.Output("Run sql-migrate new <name> to write the first migration, then sql-migrate up to apply it.")
+	return 0
+}
+
+// initProject writes the configuration file and creates the migrations
+// directory. The file is only replaced with force, the directory and the
+// migrations it holds are always kept.
+func initProject(configFile, dialect, dir string, force bool) error {
+	dataSource, ok := initDataSources[dialect]
+	if !ok {
+		return fmt.Errorf("Unknown dialect %q, use sqlite3, postgres or mysql", dialect)
+	}
+
+	var buf bytes.Buffer
+	data := struct{ Dialect, DataSource, Dir string }{dialect, dataSource, dir}
+	if err := initConfigTpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(configFile, flags, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists, use -force to overwrite it", configFile)
+		}
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	ui.Output(fmt.Sprintf("Created %s", configFile))
+
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		ui.Output(fmt.Sprintf("Directory %s already exists", dir))
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	ui.Output(fmt.Sprintf("Created directory %s", dir))
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestInitCommand(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	root := c.MkDir()
+	configFile := filepath.Join(root, "dbconfig.yml")
+	dir := filepath.Join(root, "migrations")
+	c.Assert((&InitCommand{}).Run([]string{"-config", configFile, "-dir", dir}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Created "+configFile+"\nCreated directory "+dir+"\nRun sql-migrate new <name> to write the first migration, then sql-migrate up to apply it.\n")
+
+	info, err := os.Stat(dir)
+	c.Assert(err, IsNil)
+	c.Assert(info.IsDir(), Equals, true)
+
+	ConfigFile = configFile
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "sqlite3")
+	c.Assert(env.DataSource, Equals, "development.db")
+	c.Assert(env.Dir, Equals, dir)
+
+	// Existing files are kept.
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_initial.sql"), []byte("-- +migrate Up\n"), 0o644), IsNil)
+	c.Assert((&InitCommand{}).Run([]string{"-config", configFile, "-dir", dir, "-dialect", "postgres"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, configFile+" already exists, use -force to overwrite it\n")
+
+	mock.OutputWriter.Reset()
+	c.Assert((&InitCommand{}).Run([]string{"-config", configFile, "-dir", dir, "-dialect", "postgres", "-force"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Matches, "Created .*\nDirectory .* already exists\n.*\n")
+	_, err = os.Stat(filepath.Join(dir, "1_initial.sql"))
+	c.Assert(err, IsNil)
+
+	defer setenv("DB_PASSWORD", "s3cret")()
+	env, err = GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "postgres")
+	c.Assert(env.DataSource, Equals, "host=localhost dbname=myapp user=myapp password=s3cret sslmode=disable")
+}
+
+func (*ConfigSuite) TestInitCommandDialect(c *C) {
+	err := initProject(filepath.Join(c.MkDir(), "dbconfig.yml"), "oracle", "migrations", false)
+	c.Assert(err, ErrorMatches, `Unknown dialect "oracle", use sqlite3, postgres or mysql`)
+}
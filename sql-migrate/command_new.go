@@ -9,6 +9,8 @@ import (
 	"strings"
 	"text/template"
 	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
 )
 
 var templateContent = `
@@ -18,21 +20,24 @@ var templateContent = `
 `
 var tpl = template.Must(template.New("new_migration").Parse(templateContent))
 
+const timestampFormat = "20060102150405"
+
 type NewCommand struct{}
 
 func (*NewCommand) Help() string {
 	helpText := `
 Usage: sql-migrate new [options] name
 
-  Create a new a database migration.
+  Create a new a database migration, the name following the prefix in its
+  file name.
 
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
-  name                   The name of the migration
+  -prefix=timestamp      Prefix of the file name: timestamp (20060102150405) or
+                         sequential (the highest existing number plus one,
+                         zero-padded like the existing migrations).
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp)
 }
 
 func (*NewCommand) Synopsis() string {
@@ -40,49 +45,150 @@ func (*NewCommand) Synopsis() string {
 }
 
 func (c *NewCommand) Run(args []string) int {
+	var prefix string
+
 	cmdFlags := flag.NewFlagSet("new", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&prefix, "prefix", "timestamp", "Prefix of the file name, either timestamp or sequential.")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
 
-	if len(args) < 1 {
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if cmdFlags.NArg() < 1 {
 		err := errors.New("A name for the migration is needed")
 		ui.Error(err.Error())
 		return 1
 	}
 
-	if err := cmdFlags.Parse(args); err != nil {
+	if prefix != "timestamp" && prefix != "sequential" {
+		ui.Error(fmt.Sprintf("Invalid prefix %q, use timestamp or sequential", prefix))
 		return 1
 	}
 
-	if err := CreateMigration(cmdFlags.Arg(0)); err != nil {
+	if err := CreateMigration(cmdFlags.Arg(0), prefix); err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 	return 0
 }
 
-func CreateMigration(name string) error {
+func CreateMigration(name, prefix string) error {
 	env, err := GetEnvironment()
 	if err != nil {
 		return err
 	}
 
-	if _, err := os.Stat(env.Dir); os.IsNotExist(err) {
-		return err
+	if env.RemoteDir != "" {
+		return fmt.Errorf("Cannot create a migration in %s, set dir to a local directory", env.RemoteDir)
+	}
+	if isDirPattern(env.Dir) {
+		return fmt.Errorf("Cannot create a migration in %s, set dir to a directory", env.Dir)
 	}
 
-	fileName := fmt.Sprintf("%s-%s.sql", time.Now().Format("20060102150405"), strings.TrimSpace(name))
-	pathName := path.Join(env.Dir, fileName)
-	f, err := os.Create(pathName)
+	pathName, err := createMigrationFile(env.Dir, strings.TrimSpace(name), prefix, time.Now())
 	if err != nil {
 		return err
 	}
+
+	ui.Output(fmt.Sprintf("Created migration %s", pathName))
+	return nil
+}
+
+// createMigrationFile writes an empty migration to dir, which is created
+// when missing. Existing files are never overwritten.
+func createMigrationFile(dir, name, prefix string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	var fileName string
+	if prefix == "sequential" {
+		prefix, separator, err := nextSequence(dir)
+		if err != nil {
+			return "", err
+		}
+		fileName = prefix + separator + name + ".sql"
+	} else {
+		fileName = fmt.Sprintf("%s-%s.sql", now.Format(timestampFormat), name)
+	}
+
+	pathName := path.Join(dir, fileName)
+	f, err := os.OpenFile(pathName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return "", fmt.Errorf("Migration %s already exists", pathName)
+		}
+		return "", err
+	}
 	defer func() { _ = f.Close() }()
 
 	if err := tpl.Execute(f, nil); err != nil {
-		return err
+		return "", err
 	}
 
-	ui.Output(fmt.Sprintf("Created migration %s", pathName))
-	return nil
+	return pathName, nil
+}
+
+// nextSequence continues the numbering of the migrations in dir: it returns
+// the highest numeric prefix plus one, zero-padded like the existing ones
+// (0001, 0002, ...), and the separator used after it.
+func nextSequence(dir string) (prefix, separator string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	var highest int64
+	var width, timestamps, sequential int
+	separator = "-"
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		migration := migrate.Migration{Id: entry.Name()}
+		matches := migration.NumberPrefixMatches()
+		if len(matches) == 0 {
+			continue
+		}
+		digits := matches[1]
+
+		if isTimestamp(digits) {
+			timestamps++
+			continue
+		}
+		sequential++
+
+		if strings.HasPrefix(digits, "0") && len(digits) > width {
+			width = len(digits)
+		}
+		if n := migration.VersionInt(); n > highest {
+			highest = n
+			if rest := entry.Name()[len(digits):]; strings.HasPrefix(rest, "_") {
+				separator = "_"
+			} else {
+				separator = "-"
+			}
+		}
+	}
+
+	if timestamps > 0 {
+		if sequential > 0 {
+			return "", "", fmt.Errorf("The migrations in %s mix timestamp and sequential prefixes, rename them to use one scheme or use -prefix=timestamp", dir)
+		}
+		return "", "", fmt.Errorf("The migrations in %s use timestamp prefixes, use -prefix=timestamp", dir)
+	}
+
+	return fmt.Sprintf("%0*d", width, highest+1), separator, nil
+}
+
+// isTimestamp reports whether a numeric prefix is a timestamp as generated
+// with -prefix=timestamp.
+func isTimestamp(digits string) bool {
+	_, err := time.Parse(timestampFormat, digits)
+	return err == nil
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type NewSuite struct{}
+
+var _ = Suite(&NewSuite{})
+
+func (*NewSuite) TestCreateTimestampMigration(c *C) {
+	dir := filepath.Join(c.MkDir(), "migrations")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	pathName, err := createMigrationFile(dir, "add_users", "timestamp", now)
+	c.Assert(err, IsNil)
+	c.Assert(pathName, Equals, filepath.Join(dir, "20240102030405-add_users.sql"))
+
+	content, err := os.ReadFile(pathName)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, templateContent)
+
+	// Never overwrites an existing migration.
+	_, err = createMigrationFile(dir, "add_users", "timestamp", now)
+	c.Assert(err, ErrorMatches, "Migration .*/20240102030405-add_users.sql already exists")
+}
+
+func (*NewSuite) TestCreateSequentialMigration(c *C) {
+	dir := c.MkDir()
+
+	pathName, err := createMigrationFile(dir, "initial", "sequential", time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(pathName, Equals, filepath.Join(dir, "1-initial.sql"))
+
+	c.Assert(os.WriteFile(filepath.Join(dir, "7_record.sql"), nil, 0o600), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o600), IsNil)
+	pathName, err = createMigrationFile(dir, "users", "sequential", time.Now())
+	c.Assert(err, IsNil)
+	// The separator follows the last migration.
+	c.Assert(pathName, Equals, filepath.Join(dir, "8_users.sql"))
+}
+
+func (*NewSuite) TestCreatePaddedSequentialMigration(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "0001_initial.sql"), nil, 0o600), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "0009_record.sql"), nil, 0o600), IsNil)
+
+	pathName, err := createMigrationFile(dir, "users", "sequential", time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(pathName, Equals, filepath.Join(dir, "0010_users.sql"))
+}
+
+func (*NewSuite) TestSequentialMigrationWithTimestamps(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "20240102030405-initial.sql"), nil, 0o600), IsNil)
+
+	_, err := createMigrationFile(dir, "users", "sequential", time.Now())
+	c.Assert(err, ErrorMatches, "The migrations in .* use timestamp prefixes, use -prefix=timestamp")
+
+	c.Assert(os.WriteFile(filepath.Join(dir, "0002_record.sql"), nil, 0o600), IsNil)
+	_, err = createMigrationFile(dir, "users", "sequential", time.Now())
+	c.Assert(err, ErrorMatches, "The migrations in .* mix timestamp and sequential prefixes, .*")
+}
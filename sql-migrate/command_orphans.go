@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type OrphansCommand struct{}
+
+func (*OrphansCommand) Help() string {
+	helpText := `
+Usage: sql-migrate orphans [options] ...
+
+  List the orphan migrations: those recorded as applied in the migration
+  table, but without a migration file any more. They are reported whatever
+  ignoreunknown is set to. Nothing is written to the database.
+
+  With -strict, exits with 1 when orphan migrations are found.
+
+Options:
+
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp)
+}
+
+func (*OrphansCommand) Synopsis() string {
+	return "List the applied migrations without a migration file"
+}
+
+func (c *OrphansCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("orphans", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	migrations, err := migrationSource(env).FindMigrations()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	// Nothing was applied yet.
+	var records []*migrate.MigrationRecord
+	if migrationTableExists(db, env) {
+		records, err = environmentMigrationSet(env).GetMigrationRecords(db, dialect)
+		if err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	orphans := findOrphans(records, migrations)
+	if len(orphans) == 0 {
+		ui.Output("No orphan migrations")
+		return 0
+	}
+
+	ui.Output(fmt.Sprintf("Migration table %s has %d applied migrations without a migration file:", qualifiedMigrationTableName(env), len(orphans)))
+	for _, r := range orphans {
+		ui.Output(fmt.Sprintf("  %s, applied at %s", r.Id, r.AppliedAt.UTC().Format(time.RFC3339)))
+	}
+
+	if ConfigStrict {
+		ui.Error(fmt.Sprintf("Found %d orphan migrations (-strict)", len(orphans)))
+		return 1
+	}
+	return 0
+}
+
+// findOrphans returns the records of the applied migrations that have no
+// migration, in the order they were applied.
+func findOrphans(records []*migrate.MigrationRecord, migrations []*migrate.Migration) []*migrate.MigrationRecord {
+	known := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Id] = true
+	}
+
+	var orphans []*migrate.MigrationRecord
+	for _, r := range records {
+		if !known[r.Id] {
+			orphans = append(orphans, r)
+		}
+	}
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphans[i].AppliedAt.Before(orphans[j].AppliedAt)
+	})
+	return orphans
+}
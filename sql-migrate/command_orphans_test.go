@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestFindOrphans(c *C) {
+	migrations := []*migrate.Migration{{Id: "1_initial.sql"}, {Id: "3_index.sql"}}
+	records := []*migrate.MigrationRecord{
+		{Id: "1_initial.sql", AppliedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Id: "4_renamed.sql", AppliedAt: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{Id: "2_deleted.sql", AppliedAt: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	orphans := findOrphans(records, migrations)
+	c.Assert(orphans, HasLen, 2)
+	c.Assert(orphans[0].Id, Equals, "2_deleted.sql")
+	c.Assert(orphans[1].Id, Equals, "4_renamed.sql")
+
+	c.Assert(findOrphans(records[:1], migrations), HasLen, 0)
+}
+
+func (*ConfigSuite) TestOrphansCommand(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	config := `
+development:
+  dialect: sqlite3
+  datasource: ` + filepath.Join(c.MkDir(), "test.db") + `
+  dir: ../test-migrations
+`
+	writeConfig(c, config)
+	configFile := ConfigFile
+	c.Assert((&OrphansCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "No orphan migrations\n")
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE gorp_migrations (id VARCHAR(255) PRIMARY KEY, applied_at DATETIME)")
+	c.Assert(err, IsNil)
+	_, err = db.Exec("INSERT INTO gorp_migrations VALUES ('1_initial.sql', ?), ('0_removed.sql', ?)", time.Now(), time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	c.Assert(err, IsNil)
+
+	mock.OutputWriter.Reset()
+	c.Assert((&OrphansCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Migration table gorp_migrations has 1 applied migrations without a migration file:\n  0_removed.sql, applied at 2024-03-01T12:00:00Z\n")
+
+	defer func() { ConfigStrict = false }()
+	c.Assert((&OrphansCommand{}).Run([]string{"-config", configFile, "-strict"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Found 1 orphan migrations (-strict)\n")
+}
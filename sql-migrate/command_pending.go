@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// exitPending is the exit code of the pending command when there are
+// migrations to apply, which sets it apart from errors.
+const exitPending = 2
+
+type PendingCommand struct{}
+
+func (*PendingCommand) Help() string {
+	helpText := `
+Usage: sql-migrate pending [options] ...
+
+  List the migrations that up would apply, in order, with the file of each.
+
+  Exits with 0 when there is nothing to apply, 2 when migrations are pending
+  and 1 on errors.
+
+Options:
+
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp)
+}
+
+func (*PendingCommand) Synopsis() string {
+	return "List the pending migrations"
+}
+
+func (c *PendingCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("pending", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	source := migrationSource(env)
+	migrations, err := PlanMigrations(db, dialect, env, source, migrate.Up, 0, -1)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Cannot plan migration: %s", err))
+		return 1
+	}
+
+	if len(migrations) == 0 {
+		ui.Output("No pending migrations")
+		return 0
+	}
+
+	for _, m := range migrations {
+		ui.Output(fmt.Sprintf("%s\t%s", colorPending.Sprint(m.Id), migrationFile(env, source, m.Id)))
+	}
+	return exitPending
+}
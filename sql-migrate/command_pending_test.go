@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestPendingCommandExitCodes(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+
+	// Without a migration table, all the migrations are pending.
+	c.Assert((&PendingCommand{}).Run([]string{"-config", configFile}), Equals, exitPending)
+	c.Assert(mock.OutputWriter.String(), Equals, "1_initial.sql\t../test-migrations/1_initial.sql\n2_record.sql\t../test-migrations/2_record.sql\n")
+
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile, "-limit", "1"}), Equals, 0)
+	mock.OutputWriter.Reset()
+	c.Assert((&PendingCommand{}).Run([]string{"-config", configFile}), Equals, exitPending)
+	c.Assert(mock.OutputWriter.String(), Equals, "2_record.sql\t../test-migrations/2_record.sql\n")
+
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	mock.OutputWriter.Reset()
+	c.Assert((&PendingCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "No pending migrations\n")
+
+	c.Assert((&PendingCommand{}).Run([]string{"-config", filepath.Join(c.MkDir(), "missing.yml")}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Matches, "Could not parse config: .*missing.yml.*\n")
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -14,16 +19,28 @@ func (*RedoCommand) Help() string {
 	helpText := `
 Usage: sql-migrate redo [options] ...
 
-  Reapply the last migration.
+  Reapply the last migration, or the last N ones with -limit. The
+  migrations are reverted and reapplied in a single transaction, unless
+  the dialect commits schema changes implicitly (MySQL, Oracle) or one of
+  them is marked notransaction.
 
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
-  -dryrun                Don't apply migrations, just print them.
-
+  -dryrun, -dry-run      Don't apply migrations, just print them.
+  -limit=1               Number of migrations to reapply.
+  -metrics-file=path     Write the duration of the migrations to this file, in the
+                         Prometheus text format.
+  -statement-timeout=0   Abort statements running longer than this duration, such
+                         as 30s, on Postgres and MySQL (0 = no limit). MySQL only
+                         limits SELECT statements, not DDL.
+  -verbose-sql           Log each statement before it runs, and its duration
+                         after it, even without -v.
+  -lock-timeout=5m       Maximum time to wait for another migration run to finish
+                         (0 = no limit).
+  -force-unlock          Break a lock table entry older than the lockttl of the
+                         environment.
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp, promptHelp)
 }
 
 func (*RedoCommand) Synopsis() string {
@@ -32,34 +49,90 @@ func (*RedoCommand) Synopsis() string {
 
 func (c *RedoCommand) Run(args []string) int {
 	var dryrun bool
+	var limit int
 
 	cmdFlags := flag.NewFlagSet("redo", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	cmdFlags.BoolVar(&dryrun, "dry-run", false, "Alias of -dryrun.")
+	cmdFlags.IntVar(&limit, "limit", 1, "Number of migrations to reapply.")
+	cmdFlags.StringVar(&MetricsFile, "metrics-file", "", "Write the duration of the migrations to this file, in the Prometheus text format.")
+	cmdFlags.DurationVar(&StatementTimeout, "statement-timeout", 0, "Abort statements running longer than this duration (0 = no limit).")
+	cmdFlags.BoolVar(&VerboseSql, "verbose-sql", false, "Log each statement before it runs, and its duration after it.")
+	cmdFlags.DurationVar(&LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another migration run to finish (0 = no limit).")
+	cmdFlags.BoolVar(&ForceUnlock, "force-unlock", false, "Break a lock table entry older than the lockttl of the environment.")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+	promptFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if limit < 1 {
+		ui.Error("-limit must be at least 1")
+		return 1
+	}
+
 	env, err := GetEnvironment()
 	if err != nil {
 		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
 		return 1
 	}
 
-	db, dialect, err := GetConnection(env)
+	var hooks *hookSet
+	if !dryrun {
+		if hooks, err = loadHookSet(env); err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	ctx, stop, err := interruptContext()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer stop()
+
+	db, dialect, err := GetConnectionContext(ctx, env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	if !dryrun {
+		hooks.pinConnection(db)
+		unlock, err := lockMigrations(ctx, db, env)
+		if err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+		defer unlock()
 	}
 
-	migrations, _, err := migrate.PlanMigration(db, dialect, source, migrate.Down, 1)
+	source := migrationSource(env)
+	migrationSet := environmentMigrationSet(env)
+	migrationSet.StatementStarted = logStatementStarted
+	migrationSet.StatementExecuted = logStatementExecuted
+
+	var migrations []*migrate.PlannedMigration
+	var dbMap *gorp.DbMap
+	if dryrun {
+		migrations, err = PlanMigrations(db, dialect, env, source, migrate.Down, limit, -1)
+	} else {
+		migrations, dbMap, err = migrationSet.PlanMigration(db, dialect, source, migrate.Down, limit)
+	}
 	if err != nil {
 		ui.Error(fmt.Sprintf("Migration (redo) failed: %v", err))
 		return 1
@@ -69,23 +142,211 @@ func (c *RedoCommand) Run(args []string) int {
 	}
 
 	if dryrun {
-		PrintMigration(migrations[0], migrate.Down)
-		PrintMigration(migrations[0], migrate.Up)
+		for _, m := range migrations {
+			PrintMigration(m, migrate.Down)
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			PrintMigration(migrations[i], migrate.Up)
+		}
+		return 0
+	}
+
+	action := fmt.Sprintf("Redo migration %s", migrations[0].Id)
+	if len(migrations) > 1 {
+		action = fmt.Sprintf("Redo %d migrations", len(migrations))
+	}
+	if err := confirmProduction(env, action); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if err := createSchemas(ctx, db, env); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	audit, err := openAuditLog(db, env)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	run := newRunMetrics("redo")
+	applied := audit.wrap(run.applied)
+	migrationSet.MigrationApplied = applied
+	defer func() {
+		if err := run.write(err == nil); err != nil {
+			ui.Warn(fmt.Sprintf("Cannot write metrics: %s", err))
+		}
+	}()
+
+	if err = hooks.runBefore(ctx, db); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	err = redoMigrations(ctx, db, dialect, env, migrationSet, source, dbMap, migrations, run, applied)
+
+	// The after hooks run even when the redo failed, to undo what the
+	// before hooks did.
+	hookErr := hooks.runAfter(ctx, db)
+	if hookErr != nil && err != nil {
+		ui.Warn(hookErr.Error())
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if len(migrations) == 1 {
+		ui.Output(colorApplied.Sprintf("Reapplied migration %s.", migrations[0].Id))
+	} else {
+		ui.Output(colorApplied.Sprintf("Reapplied %d migrations.", len(migrations)))
+	}
+
+	if hookErr != nil {
+		ui.Error(fmt.Sprintf("%s, the migrations reapplied are kept", hookErr))
+		return 1
+	}
+	return 0
+}
+
+// redoMigrations reverts and reapplies the planned migrations, in a single
+// transaction when possible, and records their checksums again.
+func redoMigrations(ctx context.Context, db *sql.DB, dialect string, env *Environment, migrationSet migrate.MigrationSet, source migrate.MigrationSource, dbMap *gorp.DbMap, migrations []*migrate.PlannedMigration, run *runMetrics, applied func(*migrate.PlannedMigration, migrate.MigrationDirection, time.Duration)) error {
+	if canRedoInTransaction(env, migrations) {
+		err := redoInTransaction(ctx, dbMap, migrations, run, applied)
+		if err != nil && interrupted(ctx) {
+			return errors.New(interruptionReason(ctx) + ", the redo was rolled back")
+		} else if err != nil {
+			return fmt.Errorf("Migration (redo) failed: %w", err)
+		}
+
+		// The reapplied migrations may have changed, their checksums are
+		// recorded again.
+		if err := forgetChecksums(db, env, migrations); err != nil {
+			return err
+		}
 	} else {
-		_, err := migrate.ExecMax(db, dialect, source, migrate.Down, 1)
+		n, err := migrationSet.ExecMaxContext(ctx, db, dialect, source, migrate.Down, len(migrations))
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (down) failed: %s", err))
-			return 1
+			run.failed(migrate.Down, err)
+			if interrupted(ctx) {
+				return interruptedError(ctx, err, migrate.Down, n)
+			}
+			return fmt.Errorf("Migration (down) failed: %w", err)
+		}
+
+		// Drops the checksums of the reverted migrations, so that the ones
+		// of the reapplied versions are recorded.
+		if err := syncChecksums(db, dialect, env, source); err != nil {
+			return err
 		}
 
-		_, err = migrate.ExecMax(db, dialect, source, migrate.Up, 1)
+		n, err = migrationSet.ExecMaxContext(ctx, db, dialect, source, migrate.Up, len(migrations))
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (up) failed: %s", err))
-			return 1
+			run.failed(migrate.Up, err)
+			if interrupted(ctx) {
+				return interruptedError(ctx, err, migrate.Up, n)
+			}
+			return fmt.Errorf("Migration (up) failed: %w", err)
 		}
+	}
 
-		ui.Output(fmt.Sprintf("Reapplied migration %s.", migrations[0].Id))
+	return syncChecksums(db, dialect, env, source)
+}
+
+// transactionalDdl lists the dialects (as resolved by driverName) that can
+// roll back schema changes. MySQL and Oracle commit DDL statements
+// implicitly, a transaction around them would not make redo atomic.
+var transactionalDdl = map[string]bool{
+	"postgres": true,
+	"sqlite3":  true,
+	"mssql":    true,
+}
+
+// canRedoInTransaction reports whether the migrations can be reverted and
+// reapplied in a single transaction.
+func canRedoInTransaction(env *Environment, migrations []*migrate.PlannedMigration) bool {
+	if !transactionalDdl[driverName(env.Dialect)] {
+		return false
 	}
+	for _, m := range migrations {
+		if m.DisableTransactionDown || m.DisableTransactionUp {
+			return false
+		}
+	}
+	return true
+}
 
-	return 0
+// redoInTransaction reverts the planned migrations, newest first, and
+// reapplies them in a single transaction, so that a failure leaves the
+// database as it was. The migrations are reported to applied once the
+// transaction is committed, a failure to run.
+func redoInTransaction(ctx context.Context, dbMap *gorp.DbMap, migrations []*migrate.PlannedMigration, run *runMetrics, applied func(*migrate.PlannedMigration, migrate.MigrationDirection, time.Duration)) error {
+	tx, err := dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	executor := tx.WithContext(ctx)
+
+	type step struct {
+		migration *migrate.PlannedMigration
+		dir       migrate.MigrationDirection
+		duration  time.Duration
+	}
+	var steps []step
+
+	exec := func(m *migrate.PlannedMigration, dir migrate.MigrationDirection) error {
+		start := time.Now()
+		queries := m.Down
+		if dir == migrate.Up {
+			queries = m.Up
+		}
+		for _, stmt := range queries {
+			if err := execStatement(executor, m, trimStatement(stmt)); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if dir == migrate.Up {
+			err = executor.Insert(&migrate.MigrationRecord{Id: m.Id, AppliedAt: time.Now()})
+		} else {
+			_, err = executor.Delete(&migrate.MigrationRecord{Id: m.Id})
+		}
+		if err != nil {
+			return err
+		}
+
+		steps = append(steps, step{migration: m, dir: dir, duration: time.Since(start)})
+		return nil
+	}
+
+	fail := func(m *migrate.PlannedMigration, dir migrate.MigrationDirection, err error) error {
+		_ = tx.Rollback()
+		txErr := &migrate.TxError{Migration: m.Migration, Err: err}
+		run.failed(dir, txErr)
+		return txErr
+	}
+
+	for _, m := range migrations {
+		if err := exec(m, migrate.Down); err != nil {
+			return fail(m, migrate.Down, err)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if err := exec(migrations[i], migrate.Up); err != nil {
+			return fail(migrations[i], migrate.Up, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		applied(s.migration, s.dir, s.duration)
+	}
+	return nil
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type RedoSuite struct {
+	db     *sql.DB
+	source *migrate.MemoryMigrationSource
+}
+
+var _ = Suite(&RedoSuite{})
+
+func (s *RedoSuite) SetUpTest(c *C) {
+	var err error
+	s.db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+	s.db.SetMaxOpenConns(1)
+
+	migrate.SetTable("redo_migrations")
+	migrate.SetSchema("")
+
+	s.source = &migrate.MemoryMigrationSource{Migrations: []*migrate.Migration{
+		{Id: "1_initial.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+		{Id: "2_index.sql", Up: []string{"CREATE INDEX people_id ON people (id)"}, Down: []string{"DROP INDEX people_id"}},
+		{Id: "3_record.sql", Up: []string{"INSERT INTO people (id) VALUES (1)"}, Down: []string{"DELETE FROM people"}},
+	}}
+	_, err = migrate.Exec(s.db, "sqlite3", s.source, migrate.Up)
+	c.Assert(err, IsNil)
+}
+
+func (s *RedoSuite) TearDownTest(c *C) {
+	c.Assert(s.db.Close(), IsNil)
+}
+
+func (s *RedoSuite) TestRedoInTransaction(c *C) {
+	migrations, dbMap, err := migrate.PlanMigration(s.db, "sqlite3", s.source, migrate.Down, 2)
+	c.Assert(err, IsNil)
+
+	run := newRunMetrics("redo")
+	c.Assert(redoInTransaction(context.Background(), dbMap, migrations, run, run.applied), IsNil)
+
+	var directions []string
+	for _, m := range run.migrations {
+		directions = append(directions, m.Id+" "+m.Direction)
+	}
+	c.Assert(directions, DeepEquals, []string{"3_record.sql down", "2_index.sql down", "2_index.sql up", "3_record.sql up"})
+
+	var count int
+	c.Assert(s.db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count), IsNil)
+	c.Assert(count, Equals, 1)
+
+	records, err := migrate.GetMigrationRecords(s.db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 3)
+}
+
+func (s *RedoSuite) TestRedoInTransactionRollsBack(c *C) {
+	s.source.Migrations[2].Up = []string{"INSERT INTO missing (id) VALUES (1)"}
+
+	migrations, dbMap, err := migrate.PlanMigration(s.db, "sqlite3", s.source, migrate.Down, 2)
+	c.Assert(err, IsNil)
+
+	run := newRunMetrics("redo")
+	err = redoInTransaction(context.Background(), dbMap, migrations, run, run.applied)
+	c.Assert(err, ErrorMatches, "no such table: missing handling 3_record.sql")
+	c.Assert(run.migrations, HasLen, 1)
+	c.Assert(run.migrations[0].Direction, Equals, "up")
+	c.Assert(run.migrations[0].Failed, Equals, true)
+
+	// The reverted migrations are back, along with their records.
+	var count int
+	c.Assert(s.db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count), IsNil)
+	c.Assert(count, Equals, 1)
+
+	records, err := migrate.GetMigrationRecords(s.db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 3)
+}
+
+func (*RedoSuite) TestCanRedoInTransaction(c *C) {
+	migrations := []*migrate.PlannedMigration{{Migration: &migrate.Migration{Id: "1_initial.sql"}}}
+	c.Assert(canRedoInTransaction(&Environment{Dialect: "postgres"}, migrations), Equals, true)
+	c.Assert(canRedoInTransaction(&Environment{Dialect: "cockroachdb"}, migrations), Equals, true)
+	c.Assert(canRedoInTransaction(&Environment{Dialect: "mysql"}, migrations), Equals, false)
+
+	migrations[0].DisableTransactionUp = true
+	c.Assert(canRedoInTransaction(&Environment{Dialect: "postgres"}, migrations), Equals, false)
+}
+
+func (*ConfigSuite) TestRedoCommandMetricsOnChecksumFailure(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	ui = cli.NewMockUi()
+	defer func() { MetricsFile = "" }()
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+	_, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, IsNil)
+
+	// A checksum table that cannot be read fails the redo once the
+	// migration was reapplied.
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE gorp_migrations_checksums (other int)")
+	c.Assert(err, IsNil)
+
+	metrics := filepath.Join(c.MkDir(), "redo.prom")
+	c.Assert((&RedoCommand{}).Run([]string{"-config", configFile, "-metrics-file", metrics}), Equals, 1)
+	content, err := os.ReadFile(metrics)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, `(?s).*command="redo",status="failure".*`)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"strings"
+	"time"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -12,37 +14,59 @@ type SkipCommand struct{}
 
 func (*SkipCommand) Help() string {
 	helpText := `
-Usage: sql-migrate skip [options] ...
+Usage: sql-migrate skip [options] [migration ...]
 
-  Set the database level to the most recent version available, without actually running the migrations.
+  Mark pending migrations as applied, without running them, for instance
+  after applying a change by hand. Without arguments, all pending
+  migrations are marked (or the first N with -limit), otherwise only the
+  given ones: by id, id without .sql or numeric prefix.
 
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
   -limit=0               Limit the number of migrations (0 = unlimited).
-
+  -lock-timeout=5m       Maximum time to wait for another migration run to finish
+                         (0 = no limit).
+  -force-unlock          Break a lock table entry older than the lockttl of the
+                         environment.
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp, promptHelp)
 }
 
 func (*SkipCommand) Synopsis() string {
-	return "Sets the database level to the most recent version available, without running the migrations"
+	return "Mark pending migrations as applied, without running them"
 }
 
 func (c *SkipCommand) Run(args []string) int {
 	var limit int
 
-	cmdFlags := flag.NewFlagSet("up", flag.ContinueOnError)
+	cmdFlags := flag.NewFlagSet("skip", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to skip.")
+	cmdFlags.DurationVar(&LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another migration run to finish (0 = no limit).")
+	cmdFlags.BoolVar(&ForceUnlock, "force-unlock", false, "Break a lock table entry older than the lockttl of the environment.")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+	promptFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	err := SkipMigrations(migrate.Up, limit)
+	if limit != 0 && cmdFlags.NArg() > 0 {
+		ui.Error("Give either -limit or the migrations to skip, not both")
+		return 1
+	}
+
+	err := SkipMigrations(limit, cmdFlags.Args())
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
@@ -51,7 +75,9 @@ func (c *SkipCommand) Run(args []string) int {
 	return 0
 }
 
-func SkipMigrations(dir migrate.MigrationDirection, limit int) error {
+// SkipMigrations records pending migrations as applied without running
+// them: the given ones, or else the first limit (0 = all).
+func SkipMigrations(limit int, names []string) error {
 	env, err := GetEnvironment()
 	if err != nil {
 		return fmt.Errorf("Could not parse config: %w", err)
@@ -63,23 +89,103 @@ func SkipMigrations(dir migrate.MigrationDirection, limit int) error {
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	unlock, err := lockMigrations(context.Background(), db, env)
+	if err != nil {
+		return err
 	}
+	defer unlock()
+
+	if err := createSchemas(context.Background(), db, env); err != nil {
+		return err
+	}
+
+	source := migrationSource(env)
 
-	n, err := migrate.SkipMax(db, dialect, source, dir, limit)
+	pending, dbMap, err := environmentMigrationSet(env).PlanMigration(db, dialect, source, migrate.Up, 0)
 	if err != nil {
-		return fmt.Errorf("Migration failed: %w", err)
+		return fmt.Errorf("Cannot plan migration: %w", err)
 	}
 
-	switch n {
-	case 0:
+	skipped, err := selectSkipped(source, pending, limit, names)
+	if err != nil {
+		return err
+	}
+	if len(skipped) == 0 {
 		ui.Output("All migrations have already been applied")
-	case 1:
+		return nil
+	}
+
+	if err := confirmProduction(env, fmt.Sprintf("Mark %d migrations as applied without running them", len(skipped))); err != nil {
+		return err
+	}
+
+	tx, err := dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	for _, m := range skipped {
+		if err := tx.Insert(&migrate.MigrationRecord{Id: m.Id, AppliedAt: time.Now()}); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("Cannot skip migration %s: %w", m.Id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := syncChecksums(db, dialect, env, source); err != nil {
+		return err
+	}
+
+	for _, m := range skipped {
+		ui.Output(fmt.Sprintf("Skipped migration %s", m.Id))
+	}
+	if len(skipped) == 1 {
 		ui.Output("Skipped 1 migration")
-	default:
-		ui.Output(fmt.Sprintf("Skipped %d migrations", n))
+	} else {
+		ui.Output(fmt.Sprintf("Skipped %d migrations", len(skipped)))
 	}
 
 	return nil
 }
+
+// selectSkipped picks the pending migrations to skip: the named ones in the
+// order they would be applied, or else the first limit (0 = all).
+func selectSkipped(source migrate.MigrationSource, pending []*migrate.PlannedMigration, limit int, names []string) ([]*migrate.PlannedMigration, error) {
+	if len(names) == 0 {
+		if limit > 0 && limit < len(pending) {
+			pending = pending[:limit]
+		}
+		return pending, nil
+	}
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(names))
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		id, err := findMigrationId(migrations, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		selected[id] = true
+	}
+
+	var skipped []*migrate.PlannedMigration
+	for _, m := range pending {
+		if selected[m.Id] {
+			skipped = append(skipped, m)
+			delete(selected, m.Id)
+		}
+	}
+	for _, id := range ids {
+		if selected[id] {
+			return nil, fmt.Errorf("Migration %s is already applied", id)
+		}
+	}
+	return skipped, nil
+}
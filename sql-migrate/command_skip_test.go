@@ -0,0 +1,57 @@
+package main
+
+import (
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type SkipSuite struct {
+	source  *migrate.MemoryMigrationSource
+	pending []*migrate.PlannedMigration
+}
+
+var _ = Suite(&SkipSuite{})
+
+func (s *SkipSuite) SetUpTest(*C) {
+	s.source = &migrate.MemoryMigrationSource{Migrations: []*migrate.Migration{
+		{Id: "1_initial.sql"},
+		{Id: "2_record.sql"},
+		{Id: "3_index.sql"},
+	}}
+	s.pending = []*migrate.PlannedMigration{
+		{Migration: s.source.Migrations[1]},
+		{Migration: s.source.Migrations[2]},
+	}
+}
+
+func skippedIds(migrations []*migrate.PlannedMigration) []string {
+	ids := []string{}
+	for _, m := range migrations {
+		ids = append(ids, m.Id)
+	}
+	return ids
+}
+
+func (s *SkipSuite) TestSelectSkippedLimit(c *C) {
+	skipped, err := selectSkipped(s.source, s.pending, 0, nil)
+	c.Assert(err, IsNil)
+	c.Assert(skippedIds(skipped), DeepEquals, []string{"2_record.sql", "3_index.sql"})
+
+	skipped, err = selectSkipped(s.source, s.pending, 1, nil)
+	c.Assert(err, IsNil)
+	c.Assert(skippedIds(skipped), DeepEquals, []string{"2_record.sql"})
+}
+
+func (s *SkipSuite) TestSelectSkippedNamed(c *C) {
+	skipped, err := selectSkipped(s.source, s.pending, 0, []string{"3", "2_record"})
+	c.Assert(err, IsNil)
+	c.Assert(skippedIds(skipped), DeepEquals, []string{"2_record.sql", "3_index.sql"})
+
+	_, err = selectSkipped(s.source, s.pending, 0, []string{"3", "1_initial.sql"})
+	c.Assert(err, ErrorMatches, "Migration 1_initial.sql is already applied")
+
+	_, err = selectSkipped(s.source, s.pending, 0, []string{"4"})
+	c.Assert(err, ErrorMatches, "Unknown migration 4")
+}
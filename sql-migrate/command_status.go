@@ -1,10 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
@@ -22,11 +22,11 @@ Usage: sql-migrate status [options] ...
 
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
-
+  -format=table          Output format, either table or json.
+  -limit=0               Only show the last N migrations, along with a summary
+                         (0 = unlimited).
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp)
 }
 
 func (*StatusCommand) Synopsis() string {
@@ -34,14 +34,30 @@ func (*StatusCommand) Synopsis() string {
 }
 
 func (c *StatusCommand) Run(args []string) int {
+	var format string
+	var limit int
+
 	cmdFlags := flag.NewFlagSet("status", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&format, "format", "table", "Output format, either table or json.")
+	cmdFlags.IntVar(&limit, "limit", 0, "Only show the last N migrations (0 = unlimited).")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if format != "table" && format != "json" {
+		ui.Error(fmt.Sprintf("Unknown format: %s", format))
+		return 1
+	}
+
 	env, err := GetEnvironment()
 	if err != nil {
 		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
@@ -49,31 +65,28 @@ func (c *StatusCommand) Run(args []string) int {
 	}
 
 	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
-	}
+	source := migrationSource(env)
 	migrations, err := source.FindMigrations()
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 
-	records, err := migrate.GetMigrationRecords(db, dialect)
+	records, err := environmentMigrationSet(env).GetMigrationRecords(db, dialect)
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Migration", "Applied"})
-	table.SetColWidth(60)
-
 	rows := make(map[string]*statusRow)
 
 	for _, m := range migrations {
@@ -93,25 +106,109 @@ func (c *StatusCommand) Run(args []string) int {
 		rows[r.Id].AppliedAt = r.AppliedAt
 	}
 
+	total := len(migrations)
+	applied := 0
+	for _, m := range migrations {
+		if rows[m.Id].Migrated {
+			applied++
+		}
+	}
+	if limit > 0 && len(migrations) > limit {
+		migrations = migrations[len(migrations)-limit:]
+	}
+
+	var summary *statusSummaryJson
+	if limit > 0 {
+		summary = &statusSummaryJson{Shown: len(migrations), Total: total, Applied: applied, Pending: total - applied}
+	}
+
+	if format == "json" {
+		if err := printStatusJson(env, migrations, rows, summary); err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	ui.Output(fmt.Sprintf("Migration table: %s", qualifiedMigrationTableName(env)))
+
+	table := tablewriter.NewWriter(outputWriter())
+	table.SetHeader([]string{"Migration", "Applied"})
+	table.SetColWidth(60)
+
 	for _, m := range migrations {
 		if rows[m.Id] != nil && rows[m.Id].Migrated {
 			table.Append([]string{
 				m.Id,
-				rows[m.Id].AppliedAt.String(),
+				colorApplied.Sprint(rows[m.Id].AppliedAt.String()),
 			})
 		} else {
 			table.Append([]string{
 				m.Id,
-				"no",
+				colorPending.Sprint("no"),
 			})
 		}
 	}
 
 	table.Render()
 
+	if summary != nil {
+		ui.Output(fmt.Sprintf("Showing %d of %d migrations: %d applied, %d pending", summary.Shown, summary.Total, summary.Applied, summary.Pending))
+	}
+
 	return 0
 }
 
+type statusJson struct {
+	Environment string                `json:"environment"`
+	Dialect     string                `json:"dialect"`
+	Table       string                `json:"table"`
+	Migrations  []statusMigrationJson `json:"migrations"`
+	// Summary counts all the migrations, with -limit.
+	Summary *statusSummaryJson `json:"summary,omitempty"`
+}
+
+type statusSummaryJson struct {
+	Shown   int `json:"shown"`
+	Total   int `json:"total"`
+	Applied int `json:"applied"`
+	Pending int `json:"pending"`
+}
+
+type statusMigrationJson struct {
+	Id        string     `json:"id"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func printStatusJson(env *Environment, migrations []*migrate.Migration, rows map[string]*statusRow, summary *statusSummaryJson) error {
+	status := statusJson{
+		Environment: ConfigEnvironment,
+		Dialect:     env.Dialect,
+		Table:       qualifiedMigrationTableName(env),
+		Migrations:  make([]statusMigrationJson, 0, len(migrations)),
+		Summary:     summary,
+	}
+
+	for _, m := range migrations {
+		entry := statusMigrationJson{Id: m.Id}
+		if row := rows[m.Id]; row.Migrated {
+			appliedAt := row.AppliedAt.UTC()
+			entry.Applied = true
+			entry.AppliedAt = &appliedAt
+		}
+		status.Migrations = append(status.Migrations, entry)
+	}
+
+	out, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	ui.Output(string(out))
+	return nil
+}
+
 type statusRow struct {
 	Id        string
 	Migrated  bool
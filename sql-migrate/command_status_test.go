@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestStatusCommand(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	db := filepath.Join(c.MkDir(), "test.db")
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+db+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile, "-limit", "1"}), Equals, 0)
+
+	status := func(args ...string) statusJson {
+		mock.OutputWriter.Reset()
+		c.Assert((&StatusCommand{}).Run(append([]string{"-config", configFile, "-format", "json"}, args...)), Equals, 0)
+		var status statusJson
+		c.Assert(json.Unmarshal(mock.OutputWriter.Bytes(), &status), IsNil)
+		return status
+	}
+
+	all := status()
+	c.Assert(all.Environment, Equals, "development")
+	c.Assert(all.Dialect, Equals, "sqlite3")
+	c.Assert(all.Table, Equals, "gorp_migrations")
+	c.Assert(all.Migrations, HasLen, 2)
+	c.Assert(all.Migrations[0].Id, Equals, "1_initial.sql")
+	c.Assert(all.Migrations[0].Applied, Equals, true)
+	c.Assert(all.Migrations[0].AppliedAt, NotNil)
+	c.Assert(all.Migrations[1].Id, Equals, "2_record.sql")
+	c.Assert(all.Migrations[1].Applied, Equals, false)
+	c.Assert(all.Migrations[1].AppliedAt, IsNil)
+	c.Assert(all.Summary, IsNil)
+
+	// The summary counts the migrations left out by -limit.
+	last := status("-limit", "1")
+	c.Assert(last.Migrations, HasLen, 1)
+	c.Assert(last.Migrations[0].Id, Equals, "2_record.sql")
+	c.Assert(last.Summary, DeepEquals, &statusSummaryJson{Shown: 1, Total: 2, Applied: 1, Pending: 1})
+
+	// The table itself goes to stdout.
+	Quiet = true
+	defer func() { Quiet = false }()
+	mock.OutputWriter.Reset()
+	c.Assert((&StatusCommand{}).Run([]string{"-config", configFile, "-limit", "1"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Migration table: gorp_migrations\nShowing 1 of 2 migrations: 1 applied, 1 pending\n")
+
+	c.Assert((&StatusCommand{}).Run([]string{"-config", configFile, "-format", "xml"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Unknown format: xml\n")
+}
+
+func (*ConfigSuite) TestStatusCommandUnknownMigration(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO gorp_migrations (id, applied_at) VALUES ('3_gone.sql', CURRENT_TIMESTAMP)")
+	c.Assert(err, IsNil)
+
+	mock.OutputWriter.Reset()
+	c.Assert((&StatusCommand{}).Run([]string{"-config", configFile, "-format", "json"}), Equals, 0)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Could not find migration file: 3_gone.sql\n")
+	var status statusJson
+	c.Assert(json.Unmarshal(mock.OutputWriter.Bytes(), &status), IsNil)
+	c.Assert(status.Migrations, HasLen, 2)
+}
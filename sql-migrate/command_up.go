@@ -1,12 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"strings"
+	"time"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
 
+// exitNothingToDo is the exit code of up -exit-codes when there was no
+// migration to apply.
+const exitNothingToDo = 3
+
 type UpCommand struct{}
 
 func (*UpCommand) Help() string {
@@ -15,16 +20,45 @@ Usage: sql-migrate up [options] ...
 
   Migrates the database to the most recent version available.
 
+  Several environments can be given to -env, separated by commas. Those
+  marked as production with confirmup also require -confirm.
+
 Options:
 
-  -config=dbconfig.yml   Configuration file to use.
-  -env="development"     Environment.
   -limit=0               Limit the number of migrations (0 = unlimited).
   -version               Run migrate up to a specific version, eg: the version number of migration 1_initial.sql is 1.
-  -dryrun                Don't apply migrations, just print them.
-
+  -to=id                 Apply the pending migrations up to and including this one.
+                         Takes the id, with or without .sql, or its number.
+  -dryrun, -dry-run      Don't apply migrations, just print them.
+  -out=path              Write the statements of the pending migrations to this
+                         file, for review, instead of applying them.
+  -exit-codes            Exit with 3 instead of 0 when there was no migration to
+                         apply.
+  -metrics-file=path     Write the duration of the migrations to this file, in the
+                         Prometheus text format.
+  -statement-timeout=0   Abort statements running longer than this duration, such
+                         as 30s, on Postgres and MySQL (0 = no limit). MySQL only
+                         limits SELECT statements, not DDL.
+  -verbose-sql           Log each statement before it runs, and its duration
+                         after it, even without -v.
+  -wait=0                Keep trying to reach the database for up to this long,
+                         such as 1m, instead of -connect-retries times, for a
+                         database starting along with the migrations.
+  -lock-timeout=5m       Maximum time to wait for another migration run to finish
+                         (0 = no limit).
+  -force-unlock          Break a lock table entry older than the lockttl of the
+                         environment.
+  -single-transaction    Run all the migrations in one transaction, rolled back
+                         entirely when one fails. Refused for MySQL and Oracle,
+                         which commit schema changes implicitly.
+  -parallel=1            Number of shards to migrate at once, for environments
+                         with shards.
+  -continue-on-error     Carry on with the next environments when one of those
+                         listed in -env fails.
+  -create-db             Create the database when it doesn't exist, for local
+                         development. Refused for production environments.
 `
-	return strings.TrimSpace(helpText)
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp, promptHelp)
 }
 
 func (*UpCommand) Synopsis() string {
@@ -35,23 +69,64 @@ func (c *UpCommand) Run(args []string) int {
 	var limit int
 	var version int64
 	var dryrun bool
+	var target string
+	var exitCodes bool
 
 	cmdFlags := flag.NewFlagSet("up", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to apply.")
 	cmdFlags.Int64Var(&version, "version", -1, "Migrate up to a specific version.")
+	cmdFlags.StringVar(&target, "to", "", "Apply the pending migrations up to and including this one.")
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	cmdFlags.BoolVar(&dryrun, "dry-run", false, "Alias of -dryrun.")
+	cmdFlags.StringVar(&OutFile, "out", "", "Write the statements of the pending migrations to this file, without applying them.")
+	cmdFlags.BoolVar(&exitCodes, "exit-codes", false, "Exit with 3 instead of 0 when there was no migration to apply.")
+	cmdFlags.StringVar(&MetricsFile, "metrics-file", "", "Write the duration of the migrations to this file, in the Prometheus text format.")
+	cmdFlags.DurationVar(&StatementTimeout, "statement-timeout", 0, "Abort statements running longer than this duration (0 = no limit).")
+	cmdFlags.BoolVar(&VerboseSql, "verbose-sql", false, "Log each statement before it runs, and its duration after it.")
+	cmdFlags.DurationVar(&Wait, "wait", 0, "Keep trying to reach the database for up to this long.")
+	cmdFlags.DurationVar(&LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another migration run to finish (0 = no limit).")
+	cmdFlags.BoolVar(&ForceUnlock, "force-unlock", false, "Break a lock table entry older than the lockttl of the environment.")
+	cmdFlags.BoolVar(&SingleTransaction, "single-transaction", false, "Run all the migrations in one transaction.")
+	cmdFlags.IntVar(&ShardParallel, "parallel", 1, "Number of shards to migrate at once.")
+	cmdFlags.BoolVar(&ContinueOnError, "continue-on-error", false, "Carry on with the next environments when one of those listed in -env fails.")
+	cmdFlags.BoolVar(&CreateDatabase, "create-db", false, "Create the database when it doesn't exist.")
 	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+	promptFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	err := ApplyMigrations(migrate.Up, dryrun, limit, version)
+	if OutFile != "" {
+		dryrun = true
+	}
+
+	ctx, stop, err := interruptContext()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer stop()
+
+	n, err := ApplyMigrations(ctx, migrate.Up, dryrun, limit, version, target)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 
+	if exitCodes && n == 0 {
+		return exitNothingToDo
+	}
 	return 0
 }
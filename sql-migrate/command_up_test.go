@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestUpCommandExitCodes(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := writeVerifyMigrations(c)
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: `+dir+`
+`)
+	configFile := ConfigFile
+
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile, "-exit-codes"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Applied 2 migrations\n")
+
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile, "-exit-codes"}), Equals, exitNothingToDo)
+	// Without -exit-codes, having nothing to apply is a success.
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+
+	c.Assert(os.WriteFile(filepath.Join(dir, "3_broken.sql"), []byte("-- +migrate Up\nINSERT INTO missing (id) VALUES (1);\n"), 0o600), IsNil)
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile, "-exit-codes"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Migration failed: no such table: missing handling 3_broken.sql\n")
+}
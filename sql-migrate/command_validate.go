@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+type ValidateCommand struct{}
+
+func (*ValidateCommand) Help() string {
+	helpText := `
+Usage: sql-migrate validate [options] ...
+
+  Validate the configuration file, without running any migrations.
+
+  All environments are checked, unless one is selected with -env.
+
+Options:
+
+  -ping                  Also connect to the database of each environment.
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, outputHelp)
+}
+
+func (*ValidateCommand) Synopsis() string {
+	return "Validate the configuration and database connectivity"
+}
+
+func (c *ValidateCommand) Run(args []string) int {
+	var ping bool
+
+	cmdFlags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&ping, "ping", false, "Also connect to the database of each environment.")
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	outputFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	var names []string
+	if hasEnvironmentFlags() || isFlagSet(cmdFlags, "env") {
+		names = []string{ConfigEnvironment}
+	} else {
+		config, err := ReadConfig()
+		if err != nil {
+			ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+			return 1
+		}
+		for name := range config {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	if len(names) == 0 {
+		ui.Error(fmt.Sprintf("No environments defined in %s", ConfigFile))
+		return 1
+	}
+
+	for _, name := range names {
+		if err := ValidateEnvironment(name, ping); err != nil {
+			ui.Error(fmt.Sprintf("Environment %s: %s", name, err))
+			return 1
+		}
+		ui.Output(fmt.Sprintf("Environment %s: OK", name))
+	}
+
+	return 0
+}
+
+// ValidateEnvironment checks the settings of the named environment and,
+// with ping, connects to its database.
+func ValidateEnvironment(name string, ping bool) error {
+	env, err := getEnvironment(name)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := dialects[env.Dialect]; !exists {
+		return fmt.Errorf("unsupported dialect: %s", env.Dialect)
+	}
+
+	if !ping {
+		return nil
+	}
+
+	db, _, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// isFlagSet reports whether the flag was passed explicitly.
+func isFlagSet(f *flag.FlagSet, name string) bool {
+	set := false
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
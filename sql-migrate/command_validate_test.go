@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestValidateCommand(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+staging:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+	configFile := ConfigFile
+
+	c.Assert((&ValidateCommand{}).Run([]string{"-config", configFile, "-ping"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Environment development: OK\nEnvironment staging: OK\n")
+	c.Assert(ConfigEnvironment, Equals, "development")
+
+	mock.OutputWriter.Reset()
+	c.Assert((&ValidateCommand{}).Run([]string{"-config", configFile, "-env", "staging"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Environment staging: OK\n")
+
+	c.Assert((&ValidateCommand{}).Run([]string{"-config", configFile, "-env", "production"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "Environment production: No environment: production\n")
+}
+
+func (*ConfigSuite) TestValidateEnvironment(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+broken:
+  dialect: nosql
+  datasource: test.db
+unreachable:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "missing", "test.db")+`
+`)
+
+	c.Assert(ValidateEnvironment("development", true), IsNil)
+	c.Assert(ValidateEnvironment("broken", false), ErrorMatches, "unsupported dialect: nosql")
+	c.Assert(ValidateEnvironment("unreachable", false), IsNil)
+	c.Assert(ValidateEnvironment("unreachable", true), NotNil)
+
+	// The environment selected with -env is left as it is.
+	c.Assert(ConfigEnvironment, Equals, "development")
+	ConfigEnvironment = "staging"
+	c.Assert(ValidateEnvironment("development", false), IsNil)
+	c.Assert(ConfigEnvironment, Equals, "staging")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// exitChecksumsDrifted is the exit code of the verify command when applied
+// migrations were changed after they were applied.
+const exitChecksumsDrifted = 4
+
+type VerifyCommand struct{}
+
+func (*VerifyCommand) Help() string {
+	helpText := `
+Usage: sql-migrate verify [options] ...
+
+  Verify that the applied migrations were not changed since they were
+  applied, by comparing them with their recorded checksums.
+
+  Checksums are opt-in: run verify -record once to store the checksums of
+  the applied migrations. From then on, up, down, redo and skip keep them
+  up to date.
+
+  Exits with 4 when applied migrations were changed, listing each of them
+  with its recorded and current checksum.
+
+Options:
+
+  -record                Record the checksums of the applied migrations, replacing
+                         the ones that changed.
+  -update-checksums      Accept the changed migrations, listing each of them with
+                         its old and new checksum.
+`
+	return optionsHelp(helpText, envHelp, envFileHelp, connectionHelp, awsHelp, printDataSourceHelp, templateHelp, outputHelp)
+}
+
+func (*VerifyCommand) Synopsis() string {
+	return "Verify the checksums of the applied migrations"
+}
+
+func (c *VerifyCommand) Run(args []string) int {
+	var record bool
+	var update bool
+
+	cmdFlags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&record, "record", false, "Record the checksums of the applied migrations.")
+	cmdFlags.BoolVar(&update, "update-checksums", false, "Accept the changed migrations.")
+	ConfigFlags(cmdFlags)
+	envFlags(cmdFlags)
+	envFileFlags(cmdFlags)
+	connectionFlags(cmdFlags)
+	awsFlags(cmdFlags)
+	printDataSourceFlags(cmdFlags)
+	templateFlags(cmdFlags)
+	outputFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if record && update {
+		ui.Error("-record and -update-checksums cannot be combined")
+		return 1
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if errors.Is(err, errPrintedDataSource) {
+		return 0
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	source := migrationSource(env)
+
+	if record {
+		n, err := RecordChecksums(db, dialect, env, source, true)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Cannot record checksums: %s", err))
+			return 1
+		}
+		ui.Output(fmt.Sprintf("Recorded %d checksums in %s", n, checksumTableName(env)))
+		return 0
+	}
+
+	drift, missing, err := VerifyChecksums(db, dialect, env, source)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	for _, id := range missing {
+		ui.Warn(fmt.Sprintf("No checksum recorded for migration %s", id))
+	}
+
+	if update {
+		if len(drift) == 0 {
+			ui.Output("All applied migrations match their checksums")
+			return 0
+		}
+		if _, err := RecordChecksums(db, dialect, env, source, true); err != nil {
+			ui.Error(fmt.Sprintf("Cannot update checksums: %s", err))
+			return 1
+		}
+		for _, d := range drift {
+			ui.Output(fmt.Sprintf("Accepted migration %s (old %s, new %s)", d.Id, d.Recorded, d.Current))
+		}
+		ui.Output(fmt.Sprintf("Updated %d checksums in %s", len(drift), checksumTableName(env)))
+		return 0
+	}
+
+	for _, d := range drift {
+		ui.Error(fmt.Sprintf("Migration %s was changed after it was applied (old %s, new %s)", d.Id, d.Recorded, d.Current))
+	}
+
+	if len(drift) > 0 {
+		ui.Error(fmt.Sprintf("%d applied migrations changed, revert the changes or accept them with verify -update-checksums", len(drift)))
+		return exitChecksumsDrifted
+	}
+
+	ui.Output("All applied migrations match their checksums")
+	return 0
+}
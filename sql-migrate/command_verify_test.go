@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+// writeVerifyMigrations copies the test migrations to a directory of their
+// own, to be edited after they were applied.
+func writeVerifyMigrations(c *C) string {
+	dir := c.MkDir()
+	for _, name := range []string{"1_initial.sql", "2_record.sql"} {
+		content, err := os.ReadFile(filepath.Join("../test-migrations", name))
+		c.Assert(err, IsNil)
+		c.Assert(os.WriteFile(filepath.Join(dir, name), content, 0o600), IsNil)
+	}
+	return dir
+}
+
+func (*ConfigSuite) TestVerifyCommandExitCodes(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := writeVerifyMigrations(c)
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: `+dir+`
+`)
+	configFile := ConfigFile
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+
+	// Checksums are opt-in.
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "No checksums have been recorded in gorp_migrations_checksums yet, run verify -record first\n")
+
+	mock.ErrorWriter.Reset()
+	mock.OutputWriter.Reset()
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile, "-record"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Recorded 2 checksums in gorp_migrations_checksums\n")
+
+	mock.OutputWriter.Reset()
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "All applied migrations match their checksums\n")
+	c.Assert(mock.ErrorWriter.String(), Equals, "")
+
+	// Editing an applied migration is a drift.
+	c.Assert(os.WriteFile(filepath.Join(dir, "2_record.sql"), []byte("-- +migrate Up\nINSERT INTO people (id) VALUES (2);\n"), 0o600), IsNil)
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile}), Equals, exitChecksumsDrifted)
+	c.Assert(mock.ErrorWriter.String(), Matches, "Migration 2_record.sql was changed after it was applied \\(old [0-9a-f]+, new [0-9a-f]+\\)\n1 applied migrations changed, .*\n")
+}
+
+func (*ConfigSuite) TestVerifyCommandUpdateChecksums(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := writeVerifyMigrations(c)
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: `+dir+`
+`)
+	configFile := ConfigFile
+	c.Assert((&UpCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile, "-record"}), Equals, 0)
+
+	// Nothing to accept.
+	mock.OutputWriter.Reset()
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile, "-update-checksums"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "All applied migrations match their checksums\n")
+
+	c.Assert(os.WriteFile(filepath.Join(dir, "2_record.sql"), []byte("-- +migrate Up\nINSERT INTO people (id) VALUES (2);\n"), 0o600), IsNil)
+	mock.OutputWriter.Reset()
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile, "-update-checksums"}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Matches, `Accepted migration 2_record.sql \(old [0-9a-f]+, new [0-9a-f]+\)
+Updated 1 checksums in gorp_migrations_checksums
+`)
+	c.Assert(mock.ErrorWriter.String(), Equals, "")
+
+	// The accepted content no longer drifts.
+	mock.OutputWriter.Reset()
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "All applied migrations match their checksums\n")
+
+	c.Assert((&VerifyCommand{}).Run([]string{"-config", configFile, "-record", "-update-checksums"}), Equals, 1)
+	c.Assert(mock.ErrorWriter.String(), Equals, "-record and -update-checksums cannot be combined\n")
+}
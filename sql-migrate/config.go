@@ -1,20 +1,32 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/go-gorp/gorp/v3"
 	"gopkg.in/yaml.v2"
 
 	migrate "github.com/rubenv/sql-migrate"
+	"github.com/rubenv/sql-migrate/sqlparse"
 
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
@@ -25,29 +37,420 @@ var dialects = map[string]gorp.Dialect{
 	"sqlite3":  gorp.SqliteDialect{},
 	"postgres": gorp.PostgresDialect{},
 	"mysql":    gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"},
+
+	// CockroachDB speaks the Postgres wire protocol and accepts the DDL
+	// generated by gorp's PostgresDialect. The migration table has no
+	// SERIAL columns, so none of CockroachDB's sequence differences apply.
+	"cockroachdb": gorp.PostgresDialect{},
+}
+
+// dialectAliases maps dialects that are served by another dialect's driver
+// onto that dialect. The alias is the dialect passed to the migrate package
+// and, unless listed in sqlDrivers, the driver used for sql.Open.
+var dialectAliases = map[string]string{
+	"cockroachdb": "postgres",
+}
+
+// sqlDrivers maps dialects that are opened through a different
+// database/sql driver than the one of their alias.
+var sqlDrivers = map[string]string{}
+
+// driverName returns the name of the database/sql driver (and migrate
+// dialect) to use for the given configured dialect.
+func driverName(dialect string) string {
+	if alias, ok := dialectAliases[dialect]; ok {
+		return alias
+	}
+	return dialect
+}
+
+// sqlDriverName returns the name of the database/sql driver used to open a
+// connection for the given configured dialect.
+func sqlDriverName(dialect string) string {
+	if driver, ok := sqlDrivers[dialect]; ok {
+		return driver
+	}
+	return driverName(dialect)
 }
 
 var (
 	ConfigFile        string
 	ConfigEnvironment string
+	ConfigTable       string
+	ConfigSchema      string
+	ConfigDialect     string
+	ConfigDataSource  string
+	ConfigStrict      bool
+	ConfigTemplate    bool
+	DriverOptions     map[string]string
+	ConnectRetries    int
+
+	// Timeout bounds connecting to the database, along with fetching its
+	// secret and remote dir. Running the migrations is not limited by it.
+	Timeout time.Duration
+
+	// StatementTimeout limits the duration of each statement, set by the
+	// commands running migrations.
+	StatementTimeout time.Duration
+
+	// PrintDataSource prints the data source passed to the driver instead
+	// of connecting, set with -print-dsn.
+	PrintDataSource bool
+
+	// AwsProfile selects the profile of the shared AWS configuration used
+	// by the AWS integrations, instead of AWS_PROFILE or the default one.
+	AwsProfile string
+)
+
+// connectBackoff is the delay before the first connection retry, it doubles
+// after every attempt.
+var connectBackoff = time.Second
+
+// configFlags is the flag set given to ConfigFlags, to tell the flags passed
+// explicitly, which win over the settings of the environment, from the
+// defaults.
+var configFlags *flag.FlagSet
+
+// Help texts of the flags registered by ConfigFlags and the helpers below,
+// appended by optionsHelp to the options of the commands.
+const (
+	configHelp = `  -config=dbconfig.yml   Configuration file or URL to use, - reads it from stdin.
+                         Can be repeated to merge several files.
+  -strict                Fail on unknown settings in the configuration file, and on
+                         a data source not matching the dialect.
+  -v, -verbose           Log each step, to stderr.
+  -log-format=text       Format of the log, text or json.
+`
+	envHelp = `  -env="development"     Environment.
+`
+	envFileHelp = `  -env-file=path         Variables to expand in the configuration file, real
+                         environment variables take precedence.
+`
+	connectionHelp = `  -dialect=name          Dialect, together with -datasource instead of a
+                         configuration file.
+  -datasource=dsn        Data source, together with -dialect instead of a
+                         configuration file.
+  -connect-retries=3     Number of times to retry connecting to the database.
+  -timeout=30s           Maximum time to connect to the database (0 = no limit),
+                         not to run the command.
+  -driver-option=k=v     Driver specific data source parameter, can be repeated.
+  -table=name            Migration table, takes precedence over the table setting
+                         of the environment, which defaults to gorp_migrations.
+  -schema=name           Schema of the migration table, takes precedence over the
+                         schema setting of the environment.
+`
+	awsHelp = `  -aws-profile=name      AWS profile of Secrets Manager, IAM auth and S3 dirs, in
+                         builds with -tags aws. Defaults to AWS_PROFILE.
+`
+	printDataSourceHelp = `  -print-dsn             Print the data source passed to the driver, with the
+                         password masked, and exit without connecting.
+`
+	templateHelp = `  -template              Render the migrations as Go templates with the vars of
+                         the environment.
+`
 )
 
+// optionsHelp returns the help of a command: helpText, ending with its own
+// options, followed by the help of the flags of ConfigFlags and of the
+// shared ones it registers.
+func optionsHelp(helpText string, shared ...string) string {
+	return strings.TrimSpace(helpText + configHelp + strings.Join(shared, ""))
+}
+
+// ConfigFlags registers the flags reading the configuration files, shared
+// by all commands but init. The default of -config can be overridden through
+// the SQL_MIGRATE_CONFIG environment variable, an explicit flag still takes
+// precedence.
 func ConfigFlags(f *flag.FlagSet) {
-	f.StringVar(&ConfigFile, "config", "dbconfig.yml", "Configuration file to use.")
-	f.StringVar(&ConfigEnvironment, "env", "development", "Environment to use.")
+	configFlags = f
+	ConfigFile = getenvDefault("SQL_MIGRATE_CONFIG", "dbconfig.yml")
+	f.Var(&configFileFlag{}, "config", "Configuration file or URL to use, - reads it from stdin. Can be repeated or a comma-separated list to merge several files.")
+	f.BoolVar(&ConfigStrict, "strict", false, "Fail on unknown settings in the configuration files, and on a data source not matching the dialect.")
+	logFlags(f)
+}
+
+// envFlags adds -env, to the commands using the settings of the selected
+// environment. Its default can be overridden through SQL_MIGRATE_ENV.
+func envFlags(f *flag.FlagSet) {
+	f.StringVar(&ConfigEnvironment, "env", getenvDefault("SQL_MIGRATE_ENV", "development"), "Environment to use.")
+}
+
+// envFileFlags adds -env-file, to the commands expanding the settings of
+// environments.
+func envFileFlags(f *flag.FlagSet) {
+	f.StringVar(&EnvFile, "env-file", "", "File with variables to expand in the configuration, the environment takes precedence.")
+}
+
+// connectionFlags adds the flags giving or tuning the connection to the
+// database, to the commands connecting to it.
+func connectionFlags(f *flag.FlagSet) {
+	f.StringVar(&ConfigDialect, "dialect", "", "Dialect, together with -datasource instead of a configuration file.")
+	f.StringVar(&ConfigDataSource, "datasource", "", "Data source, together with -dialect instead of a configuration file.")
+	f.StringVar(&ConfigTable, "table", "", "Migration table, overrides the table setting of the environment.")
+	f.StringVar(&ConfigSchema, "schema", "", "Schema of the migration table, overrides the schema setting of the environment.")
+	DriverOptions = map[string]string{}
+	f.Func("driver-option", "Driver specific data source parameter as key=value, can be repeated.", func(value string) error {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return errors.New("expected key=value")
+		}
+		DriverOptions[key] = value
+		return nil
+	})
+	f.IntVar(&ConnectRetries, "connect-retries", 3, "Number of times to retry connecting to the database.")
+	f.DurationVar(&Timeout, "timeout", 30*time.Second, "Maximum time to connect to the database, not to run the migrations (0 = no limit).")
+}
+
+// templateFlags adds -template, to the commands reading the migrations.
+func templateFlags(f *flag.FlagSet) {
+	f.BoolVar(&ConfigTemplate, "template", false, "Render the migrations as Go templates with the vars of the environment.")
+}
+
+// printDataSourceFlags adds -print-dsn, to the commands connecting to the
+// database.
+func printDataSourceFlags(f *flag.FlagSet) {
+	f.BoolVar(&PrintDataSource, "print-dsn", false, "Print the data source passed to the driver, with the password masked, and exit without connecting.")
+}
+
+// awsFlags adds -aws-profile, to the commands reading the secrets, the
+// migrations or the database of an environment, any of which may be on AWS.
+func awsFlags(f *flag.FlagSet) {
+	f.StringVar(&AwsProfile, "aws-profile", "", "AWS profile of the AWS integrations, defaults to AWS_PROFILE.")
+}
+
+// configFileFlag collects the -config flags into ConfigFile, the first one
+// replaces the default and the following ones are appended.
+type configFileFlag struct {
+	set bool
+}
+
+func (*configFileFlag) String() string {
+	return ConfigFile
+}
+
+func (f *configFileFlag) Set(value string) error {
+	if f.set {
+		ConfigFile += "," + value
+	} else {
+		ConfigFile = value
+		f.set = true
+	}
+	return nil
+}
+
+func getenvDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
 
 type Environment struct {
-	Dialect       string `yaml:"dialect"`
-	DataSource    string `yaml:"datasource"`
-	Dir           string `yaml:"dir"`
-	TableName     string `yaml:"table"`
-	SchemaName    string `yaml:"schema"`
-	IgnoreUnknown bool   `yaml:"ignoreunknown"`
+	// Name is the environment the settings were selected as, naming the
+	// TLS config and the connections of the environment.
+	Name string `yaml:"-"`
+
+	Dialect       string   `yaml:"dialect"`
+	DataSource    string   `yaml:"datasource"`
+	Dir           string   `yaml:"dir"`
+	Dirs          []string `yaml:"-"`
+	Source        string   `yaml:"source"`
+	TableName     string   `yaml:"table"`
+	SchemaName    string   `yaml:"schema"`
+	IgnoreUnknown bool     `yaml:"ignoreunknown"`
+
+	// Ordering is the order of the migrations: lexical, the default, sorts
+	// them by numeric prefix and then by id, numeric compares all the
+	// numbers in the ids.
+	Ordering string `yaml:"ordering"`
+
+	// DisableCreateTable expects the migration table to exist instead of
+	// creating it, for users that cannot create tables.
+	DisableCreateTable bool `yaml:"disablecreatetable"`
+
+	// RequireWritable refuses read-only connections, such as the ones to a
+	// replica, on Postgres and MySQL.
+	RequireWritable bool `yaml:"requirewritable"`
+
+	// Production makes destructive operations require -confirm with the
+	// name of the environment, ConfirmUp extends this to up.
+	Production bool `yaml:"production"`
+	ConfirmUp  bool `yaml:"confirmup"`
+
+	// SearchPath is the Postgres search_path the migrations run with.
+	SearchPath string `yaml:"searchpath"`
+
+	// CreateSchema creates the schema of the migration table and the
+	// schemas of the search_path before migrating, on Postgres.
+	CreateSchema bool `yaml:"createschema"`
+
+	// Engine and Encoding are used for the tables created by sql-migrate on
+	// MySQL, defaulting to InnoDB and UTF8.
+	Engine   string `yaml:"engine"`
+	Encoding string `yaml:"encoding"`
+
+	// Template renders the migration files as Go templates before they are
+	// parsed, with Vars as data.
+	Template bool              `yaml:"template"`
+	Vars     map[string]string `yaml:"vars"`
+
+	// Options are driver specific parameters added to the data source.
+	Options map[string]string `yaml:"options"`
+
+	// Shards are the data sources of databases sharing the migrations, in
+	// place of datasource. up and down migrate each of them.
+	Shards []string `yaml:"shards"`
+
+	// Pragmas are PRAGMA statements run on every SQLite connection, such as
+	// PRAGMA foreign_keys=ON.
+	Pragmas []string `yaml:"pragmas"`
+
+	// Discrete connection settings, used to build the data source when
+	// datasource is not set.
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+
+	// Socket connects over a Unix socket instead of host and port: the
+	// socket file for MySQL, the directory holding it for Postgres.
+	Socket string `yaml:"socket"`
+
+	// Auth selects an alternative to password authentication: iam
+	// generates an RDS auth token for every connection.
+	Auth string `yaml:"auth"`
+
+	// Ssh tunnels the connection through a bastion host.
+	Ssh *SshSettings `yaml:"ssh"`
+
+	// Tls sets up TLS for MySQL, in place of the MYSQL_* environment
+	// variables.
+	Tls *TlsSettings `yaml:"tls"`
+
+	// Connection pool settings, left at the database/sql defaults when
+	// zero. A negative MaxIdleConns disables idle connections.
+	MaxOpenConns    int           `yaml:"maxopenconns"`
+	MaxIdleConns    int           `yaml:"maxidleconns"`
+	ConnMaxLifetime time.Duration `yaml:"connmaxlifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"connmaxidletime"`
+
+	// ConnectTimeout bounds each attempt to reach the database.
+	ConnectTimeout time.Duration `yaml:"connecttimeout"`
+
+	// Keepalive is the idle time after which the Postgres server probes
+	// the connections, unset or 0 leaves it to the server. ReadTimeout
+	// sets the readTimeout of the MySQL driver, 0 for no limit.
+	Keepalive   *time.Duration `yaml:"keepalive"`
+	ReadTimeout *time.Duration `yaml:"readtimeout"`
+
+	// Timeout and ConnectRetries replace the defaults of -timeout and
+	// -connect-retries, the flags still win when given. RetryBackoff is the
+	// delay before the first retry of the connection, and of a migration
+	// with Retries, 1s when zero. It doubles after every attempt.
+	Timeout        *time.Duration `yaml:"timeout"`
+	ConnectRetries *int           `yaml:"connectretries"`
+	RetryBackoff   time.Duration  `yaml:"retrybackoff"`
+
+	// Lock selects how runs are kept from migrating concurrently: advisory,
+	// the default, takes an advisory lock on Postgres and MySQL, table
+	// inserts a row in a lock table, on any dialect. A row older than
+	// LockTTL can be broken with -force-unlock.
+	Lock    string        `yaml:"lock"`
+	LockTTL time.Duration `yaml:"lockttl"`
+
+	// Label names the connections sql-migrate/<label>, as the application
+	// name of Postgres or a connection attribute of MySQL. The connections
+	// are left unnamed without it.
+	Label string `yaml:"label"`
+
+	// LineSeparator ends a statement on a line of its own, such as GO, in
+	// addition to semicolons, like sqlparse.LineSeparator.
+	LineSeparator string `yaml:"lineseparator"`
+
+	// AuditTable names a table receiving a row for every migration applied
+	// or reverted, with the OS user and Actor, such as ${CI_ACTOR}.
+	AuditTable string `yaml:"audittable"`
+	Actor      string `yaml:"actor"`
+
+	// RemoteDir is the dir as configured when it is a remote dir, such as
+	// s3://bucket/prefix. Dir is then the cache directory it was
+	// downloaded to.
+	RemoteDir string `yaml:"-"`
+
+	// Before and After are statements, or .sql files, that up, down, redo
+	// and apply run on the connection of the migrations, before the first
+	// migration and after the last one, such as SET
+	// session_replication_role = replica.
+	Before []string `yaml:"before"`
+	After  []string `yaml:"after"`
+
+	// Retries is the number of times up and down retry a migration that
+	// failed on a serialization failure or a deadlock, on Postgres and
+	// MySQL.
+	Retries int `yaml:"retries"`
 }
 
+// ReadConfig reads the configuration files listed in ConfigFile. When there
+// are several, they are merged: later files override the environments and
+// settings of earlier ones, settings they leave out are kept.
 func ReadConfig() (map[string]*Environment, error) {
-	file, err := os.ReadFile(ConfigFile)
+	merged := make(map[string]map[interface{}]interface{})
+	for _, name := range strings.Split(ConfigFile, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		file, err := readConfigFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "-" {
+			name = "stdin"
+		} else if isConfigURL(name) {
+			name = configURLLabel(name)
+		}
+
+		file, err = configToYaml(name, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var config map[string]map[interface{}]interface{}
+		err = yaml.Unmarshal(file, &config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if ConfigStrict {
+			if err := checkSettings(name, config); err != nil {
+				return nil, err
+			}
+		}
+
+		logger().Info("config loaded", "file", name, "environments", len(config))
+
+		for env, settings := range config {
+			if merged[env] == nil {
+				merged[env] = make(map[interface{}]interface{})
+			}
+			for key, value := range settings {
+				merged[env][key] = value
+			}
+		}
+	}
+
+	if err := resolveExtends(merged); err != nil {
+		return nil, err
+	}
+
+	dirs, err := extractDirLists(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := yaml.Marshal(merged)
 	if err != nil {
 		return nil, err
 	}
@@ -58,33 +461,381 @@ func ReadConfig() (map[string]*Environment, error) {
 		return nil, err
 	}
 
+	for name, list := range dirs {
+		if env := config[name]; env != nil {
+			env.Dirs = list
+			env.Dir = list[0]
+		}
+	}
+
 	return config, nil
 }
 
-func GetEnvironment() (*Environment, error) {
+// extractDirLists takes out the dir settings given as a list of
+// directories, which cannot be read into Environment.Dir.
+func extractDirLists(config map[string]map[interface{}]interface{}) (map[string][]string, error) {
+	lists := make(map[string][]string)
+	for name, settings := range config {
+		items, ok := settings["dir"].([]interface{})
+		if !ok {
+			continue
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("Environment %s: dir is an empty list", name)
+		}
+
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			dir, ok := item.(string)
+			if !ok || dir == "" {
+				return nil, fmt.Errorf("Environment %s: dir must list directories", name)
+			}
+			list = append(list, dir)
+		}
+		lists[name] = list
+		delete(settings, "dir")
+	}
+	return lists, nil
+}
+
+// configStdin is read by -config -. It is read once and kept, as commands
+// may read the configuration more than once.
+var (
+	configStdin   io.Reader = os.Stdin
+	stdinConfig   []byte
+	stdinConfigOk bool
+)
+
+// readConfigFile reads a configuration file, fetches it when given as a URL,
+// or reads stdin for "-".
+func readConfigFile(name string) ([]byte, error) {
+	if isConfigURL(name) {
+		return fetchConfig(name)
+	}
+	if name != "-" {
+		return os.ReadFile(name)
+	}
+	if !stdinConfigOk {
+		file, err := io.ReadAll(configStdin)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the config from stdin: %w", err)
+		}
+		stdinConfig, stdinConfigOk = file, true
+	}
+	return stdinConfig, nil
+}
+
+// configToYaml converts JSON and TOML config files to YAML, based on the
+// file extension. Decoding everything through the YAML tags guarantees the
+// same result (including durations) for every format.
+func configToYaml(name string, file []byte) ([]byte, error) {
+	var data interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case "", ".yml", ".yaml":
+		return file, nil
+	case ".json":
+		if err := json.Unmarshal(file, &data); err != nil {
+			return nil, fmt.Errorf("cannot parse JSON config: %w", err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(file, &data); err != nil {
+			return nil, fmt.Errorf("cannot parse TOML config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config file format %q, use .yml, .yaml, .json or .toml", ext)
+	}
+
+	return yaml.Marshal(data)
+}
+
+// checkSettings reports the first unknown setting in the environments of a
+// configuration file, such as a misspelled datasource, including the ones of
+// the tls and ssh blocks. The keys of options are driver parameters, they
+// are not checked. Without -strict they are ignored.
+func checkSettings(file string, config map[string]map[interface{}]interface{}) error {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if key, ok := unknownSetting(reflect.TypeOf(Environment{}), config[name], "extends"); ok {
+			return fmt.Errorf("%s: unknown setting %q in environment %s", file, key, name)
+		}
+	}
+	return nil
+}
+
+// unknownSetting returns the first key of settings that is not a field of
+// the struct type t, nor one of extra. The blocks of struct fields are
+// checked in turn, their keys are returned as block.key.
+func unknownSetting(t reflect.Type, settings map[interface{}]interface{}, extra ...string) (string, bool) {
+	fields := make(map[string]reflect.Type, t.NumField()+len(extra))
+	for i := 0; i < t.NumField(); i++ {
+		if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); tag != "" && tag != "-" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+	for _, key := range extra {
+		fields[key] = nil
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return key, true
+		}
+		if field == nil {
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			field = field.Elem()
+		}
+		block, ok := settings[key].(map[interface{}]interface{})
+		if field.Kind() != reflect.Struct || !ok {
+			continue
+		}
+		if nested, ok := unknownSetting(field, block); ok {
+			return key + "." + nested, true
+		}
+	}
+	return "", false
+}
+
+// resolveExtends fills in the settings of environments that extend another
+// one, with extends: <name>. The settings of the environment win over the
+// ones it inherits, which can themselves be inherited.
+func resolveExtends(config map[string]map[interface{}]interface{}) error {
+	resolved := make(map[string]bool, len(config))
+
+	var resolve func(name string, chain []string) error
+	resolve = func(name string, chain []string) error {
+		if resolved[name] {
+			return nil
+		}
+		for i, n := range chain {
+			if n == name {
+				return fmt.Errorf("Environment %s extends itself: %s", name, strings.Join(append(chain[i:], name), " -> "))
+			}
+		}
+
+		settings := config[name]
+		value, ok := settings["extends"]
+		if !ok {
+			resolved[name] = true
+			return nil
+		}
+
+		base, ok := value.(string)
+		if !ok || base == "" {
+			return fmt.Errorf("Environment %s: extends must be the name of an environment", name)
+		}
+		if config[base] == nil {
+			return fmt.Errorf("Environment %s extends unknown environment %s", name, base)
+		}
+		if err := resolve(base, append(chain, name)); err != nil {
+			return err
+		}
+
+		delete(settings, "extends")
+		for key, value := range config[base] {
+			if _, ok := settings[key]; !ok {
+				settings[key] = value
+			}
+		}
+		resolved[name] = true
+		return nil
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasEnvironmentFlags reports whether the environment is given on the
+// command line with -dialect and -datasource.
+func hasEnvironmentFlags() bool {
+	return ConfigDialect != "" || ConfigDataSource != ""
+}
+
+// selectEnvironment returns the environment given by the -dialect and
+// -datasource flags or, without them, the named one from the configuration
+// files.
+func selectEnvironment(name string) (*Environment, error) {
+	if hasEnvironmentFlags() {
+		if ConfigDialect == "" || ConfigDataSource == "" {
+			return nil, errors.New("-dialect and -datasource must be used together")
+		}
+		return &Environment{Dialect: ConfigDialect, DataSource: ConfigDataSource}, nil
+	}
+
 	config, err := ReadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	env := config[ConfigEnvironment]
+	if strings.Contains(name, ",") {
+		return nil, errors.New("-env lists several environments, which only up and down support")
+	}
+	env := config[name]
 	if env == nil {
-		return nil, errors.New("No environment: " + ConfigEnvironment)
+		return nil, errors.New("No environment: " + name)
 	}
+	return env, nil
+}
 
-	if env.Dialect == "" {
-		return nil, errors.New("No dialect specified")
+// GetEnvironment returns the environment selected with -env.
+func GetEnvironment() (*Environment, error) {
+	return getEnvironment(ConfigEnvironment)
+}
+
+// getEnvironment returns the named environment, with its settings expanded
+// and the flags applied.
+func getEnvironment(name string) (*Environment, error) {
+	if err := loadEnvFile(); err != nil {
+		return nil, fmt.Errorf("Cannot load env file: %w", err)
 	}
 
-	if env.DataSource == "" {
-		return nil, errors.New("No data source specified")
+	env, err := selectEnvironment(name)
+	if err != nil {
+		return nil, err
+	}
+	env.Name = name
+
+	if err := validateEnvironment(env); err != nil {
+		return nil, err
+	}
+	var expander envExpander
+	env.DataSource = expander.expand(env.DataSource)
+	for i, shard := range env.Shards {
+		env.Shards[i] = expander.expand(shard)
+	}
+	env.Host = expander.expand(env.Host)
+	env.Port = expander.expand(env.Port)
+	env.User = expander.expand(env.User)
+	env.Password = expander.expand(env.Password)
+	env.DBName = expander.expand(env.DBName)
+	env.Socket = expander.expand(env.Socket)
+	env.Dir = expander.expand(env.Dir)
+	for i, dir := range env.Dirs {
+		env.Dirs[i] = expander.expand(dir)
+	}
+	if len(env.Dirs) > 0 {
+		env.Dir = env.Dirs[0]
+	}
+	env.Source = expander.expand(env.Source)
+	env.TableName = expander.expand(env.TableName)
+	env.SchemaName = expander.expand(env.SchemaName)
+	env.SearchPath = expander.expand(env.SearchPath)
+	env.Label = expander.expand(env.Label)
+	env.AuditTable = expander.expand(env.AuditTable)
+	env.Actor = expander.expand(env.Actor)
+
+	// Flags win over the config file, which wins over the defaults.
+	if ConfigTable != "" {
+		env.TableName = ConfigTable
+	}
+	if ConfigSchema != "" {
+		env.SchemaName = ConfigSchema
+	}
+	if ConfigTemplate {
+		env.Template = true
+	}
+
+	for key, value := range env.Options {
+		env.Options[key] = expander.expand(value)
+	}
+	for key, value := range env.Vars {
+		env.Vars[key] = expander.expand(value)
+	}
+	if env.Ssh != nil {
+		env.Ssh.Host = expander.expand(env.Ssh.Host)
+		env.Ssh.User = expander.expand(env.Ssh.User)
+		env.Ssh.Key = expander.expand(env.Ssh.Key)
+		env.Ssh.KnownHosts = expander.expand(env.Ssh.KnownHosts)
+	}
+	if env.Tls != nil {
+		env.Tls.CAFile = expander.expand(env.Tls.CAFile)
+		env.Tls.CAPem = expander.expand(env.Tls.CAPem)
+		env.Tls.CertFile = expander.expand(env.Tls.CertFile)
+		env.Tls.KeyFile = expander.expand(env.Tls.KeyFile)
+		env.Tls.ServerName = expander.expand(env.Tls.ServerName)
+	}
+	if expander.err != nil {
+		return nil, expander.err
+	}
+	if len(DriverOptions) > 0 && env.Options == nil {
+		env.Options = make(map[string]string, len(DriverOptions))
+	}
+	for key, value := range DriverOptions {
+		env.Options[key] = value
+	}
+
+	if secretScheme(env.DataSource) != "" {
+		ctx, cancel := timeoutContext(context.Background(), env)
+		err = ResolveSecret(ctx, env)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	} else if env.hasConnectionFields() {
+		env.DataSource, err = BuildDataSource(env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if driverName(env.Dialect) == "mysql" && isMysqlURL(env.DataSource) {
+		env.DataSource, err = mysqlURLDataSource(env.DataSource)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, shard := range env.Shards {
+		if driverName(env.Dialect) == "mysql" && isMysqlURL(shard) {
+			env.Shards[i], err = mysqlURLDataSource(shard)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
-	env.DataSource = os.ExpandEnv(env.DataSource)
 
 	if env.Dir == "" {
 		env.Dir = "migrations"
 	}
 
+	if env.Source == "" {
+		env.Source = defaultSource
+	}
+
+	if remoteDirScheme(env.Dir) != "" {
+		ctx, cancel := timeoutContext(context.Background(), env)
+		env.RemoteDir = env.Dir
+		env.Dir, err = fetchRemoteDir(ctx, env.Dir)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		env.Dirs = nil
+	}
+
 	if env.TableName != "" {
 		migrate.SetTable(env.TableName)
 	}
@@ -93,56 +844,781 @@ func GetEnvironment() (*Environment, error) {
 		migrate.SetSchema(env.SchemaName)
 	}
 
+	sqlparse.LineSeparator = env.LineSeparator
 	migrate.SetIgnoreUnknown(env.IgnoreUnknown)
+	migrate.SetOrdering(migrationOrdering(env))
+	migrate.SetDisableCreateTable(env.DisableCreateTable)
+	migrate.SetMigrationApplied(logMigrationApplied)
+	migrate.SetStatementHooks(logStatementStarted, logStatementExecuted)
+
+	logger().Info("environment selected", "environment", env.Name, "dialect", env.Dialect, "datasource", MaskDataSource(env.DataSource), "dir", env.Dir, "source", env.Source)
 
 	return env, nil
 }
 
+// validateEnvironment checks that the required settings are present.
+func validateEnvironment(env *Environment) error {
+	if env.Dialect == "" {
+		return errors.New("No dialect specified")
+	}
+
+	// Secrets may leave some of the discrete settings to the config file.
+	if env.DataSource != "" && env.hasConnectionFields() && secretScheme(env.DataSource) == "" {
+		return errors.New("Specify either a data source or host, port, user, password and dbname, not both")
+	}
+
+	if len(env.Shards) > 0 {
+		if env.DataSource != "" || env.hasConnectionFields() {
+			return errors.New("Specify either shards or a data source, not both")
+		}
+		for _, shard := range env.Shards {
+			if shard == "" {
+				return errors.New("shards cannot contain an empty data source")
+			}
+			if secretScheme(shard) != "" {
+				return errors.New("shards cannot be read from a secret store")
+			}
+		}
+	} else if env.DataSource == "" && !env.hasConnectionFields() {
+		return errors.New("No data source specified")
+	}
+
+	if env.Socket != "" && env.Host != "" {
+		return errors.New("Specify either host or socket, not both")
+	}
+
+	if env.SearchPath != "" && driverName(env.Dialect) != "postgres" {
+		return fmt.Errorf("searchpath is not supported for dialect %s", env.Dialect)
+	}
+
+	if env.RequireWritable && driverName(env.Dialect) != "postgres" && driverName(env.Dialect) != "mysql" {
+		return fmt.Errorf("requirewritable is not supported for dialect %s", env.Dialect)
+	}
+
+	if env.CreateSchema && driverName(env.Dialect) != "postgres" {
+		return fmt.Errorf("createschema is not supported for dialect %s", env.Dialect)
+	}
+
+	if (env.Engine != "" || env.Encoding != "") && driverName(env.Dialect) != "mysql" {
+		return fmt.Errorf("engine and encoding are not supported for dialect %s", env.Dialect)
+	}
+
+	if env.Tls != nil {
+		if driverName(env.Dialect) != "mysql" {
+			return fmt.Errorf("tls is not supported for dialect %s", env.Dialect)
+		}
+		if env.Tls.CAFile == "" && env.Tls.CAPem == "" && !env.Tls.SkipVerify {
+			return errors.New("tls needs ca or capem")
+		}
+	}
+
+	if env.Ordering != "" && env.Ordering != "lexical" && env.Ordering != "numeric" {
+		return fmt.Errorf("Unknown ordering %q, use lexical or numeric", env.Ordering)
+	}
+
+	// The MySQL driver separates the connection attributes with them.
+	if driverName(env.Dialect) == "mysql" && strings.ContainsAny(env.Label, ",:") {
+		return errors.New("label cannot contain commas or colons for MySQL")
+	}
+
+	if env.Lock != "" && env.Lock != "advisory" && env.Lock != "table" {
+		return fmt.Errorf("Unknown lock %q, use advisory or table", env.Lock)
+	}
+	if env.LockTTL < 0 {
+		return errors.New("lockttl cannot be negative")
+	}
+	if env.LockTTL > 0 && env.Lock != "table" {
+		return errors.New("lockttl needs lock: table")
+	}
+
+	if len(env.Pragmas) > 0 {
+		if driverName(env.Dialect) != "sqlite3" {
+			return fmt.Errorf("pragmas is not supported for dialect %s", env.Dialect)
+		}
+		if err := checkPragmas(env.Pragmas); err != nil {
+			return err
+		}
+	}
+
+	if env.Timeout != nil && *env.Timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+	if env.ConnectRetries != nil && *env.ConnectRetries < 0 {
+		return errors.New("connectretries cannot be negative")
+	}
+	if env.RetryBackoff < 0 {
+		return errors.New("retrybackoff cannot be negative")
+	}
+
+	if env.Keepalive != nil {
+		if *env.Keepalive < 0 {
+			return errors.New("keepalive cannot be negative")
+		}
+		if driverName(env.Dialect) != "postgres" {
+			return fmt.Errorf("keepalive is not supported for dialect %s", env.Dialect)
+		}
+	}
+	if env.ReadTimeout != nil {
+		if *env.ReadTimeout < 0 {
+			return errors.New("readtimeout cannot be negative")
+		}
+		if driverName(env.Dialect) != "mysql" {
+			return fmt.Errorf("readtimeout is not supported for dialect %s", env.Dialect)
+		}
+	}
+
+	for _, entry := range append(env.Before, env.After...) {
+		if strings.TrimSpace(entry) == "" {
+			return errors.New("before and after cannot contain an empty hook")
+		}
+	}
+
+	if env.Actor != "" && env.AuditTable == "" {
+		return errors.New("actor needs audittable")
+	}
+
+	if env.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+	if env.Retries > 0 && driverName(env.Dialect) != "postgres" && driverName(env.Dialect) != "mysql" {
+		return fmt.Errorf("retries is not supported for dialect %s", env.Dialect)
+	}
+
+	if env.Ssh != nil && (env.Ssh.Host == "" || env.Ssh.User == "") {
+		return errors.New("ssh needs host and user")
+	}
+
+	if err := validateSource(env); err != nil {
+		return err
+	}
+
+	return validateAuth(env)
+}
+
+// expandEnv replaces ${var} or $var by the value of the environment variable,
+// like os.ExpandEnv. A literal dollar sign can be written as $$. As in the
+// shell, ${var:-default} falls back to default when var is unset or empty,
+// ${var-default} only when it is unset, and ${var:?message} and
+// ${var?message} fail with message instead.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := expandBraces(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		name, op, word := splitExpansion(name)
+		value, set := os.LookupEnv(name)
+		switch {
+		case op == "" || (op[0] == ':' && value != "") || (op[0] != ':' && set):
+			return value
+		case strings.HasSuffix(op, "?"):
+			if err == nil {
+				err = unsetError(name, op, word)
+			}
+			return ""
+		}
+
+		// The default may refer to other variables.
+		value, defaultErr := expandEnv(word)
+		if err == nil {
+			err = defaultErr
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// expandBraces is os.Expand, except that ${...} ends at its matching brace
+// rather than at the first one, so that a default can hold other
+// expansions, as in ${A:-${B}}.
+func expandBraces(s string, mapping func(string) string) string {
+	var buf strings.Builder
+	start := 0
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != '$' {
+			continue
+		}
+		if s[i+1] == '$' {
+			i++
+			continue
+		}
+		if s[i+1] != '{' {
+			continue
+		}
+		end := closingBrace(s, i+2)
+		if end < 0 {
+			break
+		}
+		buf.WriteString(os.Expand(s[start:i], mapping))
+		buf.WriteString(mapping(s[i+2 : end]))
+		start = end + 1
+		i = end
+	}
+	buf.WriteString(os.Expand(s[start:], mapping))
+	return buf.String()
+}
+
+// closingBrace returns the index of the brace closing the one opened before
+// s[from], or -1 when it isn't closed.
+func closingBrace(s string, from int) int {
+	depth := 1
+	for i := from; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitExpansion splits the content of ${...} into the name of the variable,
+// the operator among :-, -, :? and ?, and the word following it.
+func splitExpansion(s string) (string, string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9')
+	})
+	if i < 0 {
+		return s, "", ""
+	}
+	for _, op := range []string{":-", ":?", "-", "?"} {
+		if strings.HasPrefix(s[i:], op) {
+			return s[:i], op, s[i+len(op):]
+		}
+	}
+	return s, "", ""
+}
+
+func unsetError(name, op, message string) error {
+	problem := "is not set"
+	if op == ":?" {
+		problem = "is not set or empty"
+	}
+	if message == "" {
+		return fmt.Errorf("%s %s", name, problem)
+	}
+	return fmt.Errorf("%s %s: %s", name, problem, message)
+}
+
+// envExpander expands the settings of an environment with expandEnv,
+// keeping the first error.
+type envExpander struct {
+	err error
+}
+
+func (e *envExpander) expand(s string) string {
+	expanded, err := expandEnv(s)
+	if e.err == nil {
+		e.err = err
+	}
+	return expanded
+}
+
+// errPrintedDataSource is returned by GetConnection with -print-dsn, once the
+// data source is printed. The commands exit with 0 on it.
+var errPrintedDataSource = errors.New("the data source was printed, -print-dsn does not connect")
+
 func GetConnection(env *Environment) (*sql.DB, string, error) {
-	// Load CA cert for RDS Aurora MySQL if specified
-	if env.Dialect == "mysql" && isTlsEnabled(env) {
-		err := RegisterTlsConfig(os.Getenv("MYSQL_CA_CERT_FILE"), "custom", os.Getenv("MYSQL_HOST"))
+	return GetConnectionContext(context.Background(), env)
+}
+
+// GetConnectionContext opens the database of the environment and waits for
+// it to be reachable, giving up after the -timeout flag or when ctx is done.
+func GetConnectionContext(ctx context.Context, env *Environment) (*sql.DB, string, error) {
+	// Make sure we only accept dialects that were compiled in, before
+	// trying to connect.
+	if _, exists := dialects[env.Dialect]; !exists {
+		return nil, "", fmt.Errorf("unsupported dialect: %s", env.Dialect)
+	}
+	if err := checkDataSourceDialect(env); err != nil {
+		return nil, "", err
+	}
+	if PrintDataSource {
+		if err := printDataSources(env); err != nil {
+			return nil, "", err
+		}
+		// Nothing was opened yet, neither connections nor tunnels.
+		return nil, "", errPrintedDataSource
+	}
+	if len(env.Shards) > 0 {
+		return nil, "", errors.New("The environment has shards, which only up and down support")
+	}
+
+	ctx, cancel := timeoutContext(ctx, env)
+	defer cancel()
+
+	conn := env
+	if env.Auth != "" {
+		var err error
+		conn, err = withAuthToken(ctx, env)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	conn, err := withConnectionOptions(conn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if conn.Ssh != nil {
+		tunneled, err := withSshTunnel(ctx, conn)
 		if err != nil {
-			return nil, "", fmt.Errorf("cannot register TLS config: %w", err)
+			return nil, "", maskError(err, conn.DataSource)
 		}
+		conn = tunneled
 	}
 
-	db, err := sql.Open(env.Dialect, env.DataSource)
+	start := time.Now()
+	db, dialect, err := openConnection(ctx, conn)
 	if err != nil {
+		return nil, "", maskError(err, conn.DataSource)
+	}
+
+	logger().Info("connection opened", "dialect", dialect, "datasource", MaskDataSource(conn.DataSource), "duration", time.Since(start))
+
+	if env.RequireWritable {
+		if err := checkWritable(ctx, db, dialect); err != nil {
+			_ = db.Close()
+			return nil, "", err
+		}
+	}
+
+	if env.DisableCreateTable && !migrationTableExists(db, env) {
+		_ = db.Close()
+		return nil, "", fmt.Errorf("Migration table %s does not exist and disablecreatetable is set, create it first", qualifiedMigrationTableName(env))
+	}
+
+	return db, dialect, nil
+}
+
+// withConnectionOptions returns a copy of the environment whose data source
+// carries the driver options, along with the application name, the
+// keepalive and read timeout, and the option of -statement-timeout.
+func withConnectionOptions(env *Environment) (*Environment, error) {
+	conn := env
+	if key, value, ok := applicationNameOption(conn); ok {
+		conn = withOption(conn, key, value)
+	}
+	if key, value, ok := keepaliveOption(conn); ok {
+		conn = withOption(conn, key, value)
+	}
+
+	if conn.ReadTimeout != nil {
+		if _, ok := conn.Options["readTimeout"]; ok {
+			return nil, errors.New("readtimeout conflicts with the readTimeout option")
+		}
+		conn = withOption(conn, "readTimeout", conn.ReadTimeout.String())
+	}
+
+	if StatementTimeout > 0 {
+		key, value, err := statementTimeoutOption(conn.Dialect, StatementTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := conn.Options[key]; ok {
+			return nil, fmt.Errorf("-statement-timeout conflicts with the %s option", key)
+		}
+		conn = withOption(conn, key, value)
+	}
+
+	if len(conn.Options) > 0 {
+		dataSource, err := withDriverOptions(conn.Dialect, conn.DataSource, conn.Options)
+		if err != nil {
+			return nil, maskError(err, conn.DataSource)
+		}
+		withOptions := *conn
+		withOptions.DataSource = dataSource
+		conn = &withOptions
+	}
+	return conn, nil
+}
+
+// withOption returns a copy of the environment with an extra driver option,
+// leaving the options of env untouched.
+func withOption(env *Environment, key, value string) *Environment {
+	conn := *env
+	conn.Options = map[string]string{key: value}
+	for k, v := range env.Options {
+		conn.Options[k] = v
+	}
+	return &conn
+}
+
+// checkWritable fails when the session is read-only, which is the case on
+// replicas.
+func checkWritable(ctx context.Context, db *sql.DB, dialect string) error {
+	switch dialect {
+	case "postgres":
+		var readOnly string
+		if err := db.QueryRowContext(ctx, "SHOW transaction_read_only").Scan(&readOnly); err != nil {
+			return fmt.Errorf("cannot check whether the database is writable: %w", err)
+		}
+		if readOnly == "on" {
+			return errors.New("The database is read-only (transaction_read_only is on), point the data source at the primary")
+		}
+	case "mysql":
+		var readOnly, innodbReadOnly bool
+		if err := db.QueryRowContext(ctx, "SELECT @@global.read_only, @@global.innodb_read_only").Scan(&readOnly, &innodbReadOnly); err != nil {
+			return fmt.Errorf("cannot check whether the database is writable: %w", err)
+		}
+		if readOnly {
+			return errors.New("The database is read-only (read_only is set), point the data source at the primary")
+		}
+		if innodbReadOnly {
+			return errors.New("The database is read-only (innodb_read_only is set), point the data source at the primary")
+		}
+	}
+	return nil
+}
+
+// environmentDialect returns the dialect of the tables created by
+// sql-migrate for the environment, with the engine and encoding of a MySQL
+// environment applied. It reaches the migrate package through the migration
+// set of the environment.
+func environmentDialect(env *Environment) gorp.Dialect {
+	if driverName(env.Dialect) != "mysql" {
+		return dialects[env.Dialect]
+	}
+
+	dialect := gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"}
+	if env.Engine != "" {
+		dialect.Engine = env.Engine
+	}
+	if env.Encoding != "" {
+		dialect.Encoding = env.Encoding
+	}
+	return dialect
+}
+
+// driverDataSource returns the data source passed to the driver, with the
+// TLS, socket and search_path settings of the environment applied. The TLS
+// configs it refers to are registered with the MySQL driver.
+func driverDataSource(env *Environment) (string, error) {
+	return buildDriverDataSource(env, true)
+}
+
+// printedDataSource returns the data source driverDataSource would pass to
+// the driver, for -print-dsn, without reading the certificates or
+// registering the TLS configs.
+func printedDataSource(env *Environment) (string, error) {
+	return buildDriverDataSource(env, false)
+}
+
+// buildDriverDataSource builds the data source of driverDataSource. Unless
+// certificates is set, the certificates are neither checked nor registered.
+func buildDriverDataSource(env *Environment, certificates bool) (string, error) {
+	driver := driverName(env.Dialect)
+	dataSource := env.DataSource
+
+	// The tls settings of the environment take precedence over the MYSQL_*
+	// environment variables.
+	if driver == "mysql" && env.Tls != nil {
+		if isMysqlSocket(dataSource) {
+			return "", errors.New("TLS cannot be used over a Unix socket, remove tls from the environment")
+		}
+
+		key := tlsConfigKey(env)
+		var err error
+		dataSource, err = mysqlTlsDataSource(dataSource, key)
+		if err != nil {
+			return "", err
+		}
+
+		if certificates {
+			if env.Tls.SkipVerify {
+				ui.Warn("WARNING: TLS certificate verification is disabled (skipverify), do not use this in production!")
+			}
+
+			if err := RegisterTlsConfig(key, *env.Tls); err != nil {
+				return "", fmt.Errorf("cannot register TLS config: %w", err)
+			}
+		}
+	} else if env.Dialect == "mysql" && isTlsEnabled(env) && !certificates {
+		var err error
+		if dataSource, err = mysqlTlsDataSource(dataSource, tlsConfigKey(env)); err != nil {
+			return "", err
+		}
+	} else if env.Dialect == "mysql" && isTlsEnabled(env) {
+		// Load CA cert for RDS Aurora MySQL if specified
+		settings, err := tlsSettingsFromEnv()
+		if err != nil {
+			return "", fmt.Errorf("cannot register TLS config: %w", err)
+		}
+
+		if settings.CAPem != "" && settings.CAFile != "" {
+			ui.Warn("Both MYSQL_CA_CERT_PEM and MYSQL_CA_CERT_FILE are set, using MYSQL_CA_CERT_PEM")
+		}
+
+		if settings.SkipVerify {
+			ui.Warn("WARNING: TLS certificate verification is disabled (MYSQL_TLS_SKIP_VERIFY), do not use this in production!")
+		}
+
+		key := tlsConfigKey(env)
+		if dataSource, err = mysqlTlsDataSource(dataSource, key); err != nil {
+			return "", err
+		}
+		err = RegisterTlsConfig(key, settings)
+		if err != nil {
+			return "", fmt.Errorf("cannot register TLS config: %w", err)
+		}
+	}
+
+	if driver == "mysql" && isMysqlSocket(env.DataSource) {
+		if tls := mysqlParams(env.DataSource).Get("tls"); tls != "" && tls != "false" {
+			return "", errors.New("TLS cannot be used over a Unix socket, remove tls from the data source")
+		}
+	}
+
+	if driver == "postgres" && isPostgresSocket(dataSource) {
+		var err error
+		dataSource, err = PostgresSocketDataSource(dataSource)
+		if err != nil {
+			return "", err
+		}
+	} else if driver == "postgres" && isPostgresTlsEnabled() && !certificates {
+		var err error
+		dataSource, err = postgresVerifyFullDataSource(dataSource)
+		if err != nil {
+			return "", err
+		}
+	} else if driver == "postgres" && isPostgresTlsEnabled() {
+		var err error
+		dataSource, err = PostgresTlsDataSource(dataSource)
+		if err != nil {
+			return "", fmt.Errorf("cannot configure TLS: %w", err)
+		}
+	}
+
+	if env.SearchPath != "" {
+		var err error
+		dataSource, err = PostgresSearchPathDataSource(dataSource, env.SearchPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if driver == "postgres" {
+		if err := CheckPostgresSslMode(sqlDriverName(env.Dialect), dataSource); err != nil {
+			return "", err
+		}
+	}
+
+	return dataSource, nil
+}
+
+func openConnection(ctx context.Context, env *Environment) (*sql.DB, string, error) {
+	driver := driverName(env.Dialect)
+	dataSource, err := driverDataSource(env)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var db *sql.DB
+	if len(env.Pragmas) > 0 {
+		db = sql.OpenDB(newSqliteConnector(dataSource, env.Pragmas))
+	} else if db, err = sql.Open(sqlDriverName(env.Dialect), dataSource); err != nil {
 		return nil, "", fmt.Errorf("cannot connect to database: %w", err)
 	}
 
+	if env.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(env.MaxOpenConns)
+	}
+	if env.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(env.MaxIdleConns)
+	}
+	if env.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(env.ConnMaxLifetime)
+	}
+	if env.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(env.ConnMaxIdleTime)
+	}
+
 	// Ping the database to verify connection
-	if err := db.Ping(); err != nil {
+	backoff := retryBackoffOf(env, connectBackoff)
+	if Wait > 0 {
+		err = waitForDatabase(ctx, db, env.ConnectTimeout, backoff)
+	} else {
+		err = pingWithRetry(ctx, db, env.ConnectTimeout, connectRetries(env), backoff)
+	}
+	if err != nil {
+		_ = db.Close()
+		if driver == "postgres" {
+			err = PostgresTlsHint(err, dataSource)
+		}
 		return nil, "", fmt.Errorf("cannot ping database: %w", err)
 	}
 
-	// Make sure we only accept dialects that were compiled in.
-	_, exists := dialects[env.Dialect]
-	if !exists {
-		return nil, "", fmt.Errorf("unsupported dialect: %s", env.Dialect)
+	return db, driver, nil
+}
+
+// TlsSettings describes how the TLS connection to MySQL is set up.
+type TlsSettings struct {
+	CAFile string `yaml:"ca"`
+	// CAPem holds the CA certificates inline, it takes precedence over
+	// CAFile.
+	CAPem      string `yaml:"capem"`
+	CertFile   string `yaml:"cert"`
+	KeyFile    string `yaml:"key"`
+	ServerName string `yaml:"servername"`
+
+	// SkipVerify disables verification of the server certificate. Only
+	// meant for debugging against servers with self-signed certificates.
+	SkipVerify bool `yaml:"skipverify"`
+}
+
+// tlsSettingsFromEnv reads the TLS settings from the MYSQL_* environment
+// variables.
+func tlsSettingsFromEnv() (TlsSettings, error) {
+	settings := TlsSettings{
+		CAFile:     os.Getenv("MYSQL_CA_CERT_FILE"),
+		CAPem:      os.Getenv("MYSQL_CA_CERT_PEM"),
+		CertFile:   os.Getenv("MYSQL_CLIENT_CERT_FILE"),
+		KeyFile:    os.Getenv("MYSQL_CLIENT_KEY_FILE"),
+		ServerName: os.Getenv("MYSQL_HOST"),
 	}
 
-	return db, env.Dialect, nil
+	if v := os.Getenv("MYSQL_TLS_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return settings, fmt.Errorf("invalid MYSQL_TLS_SKIP_VERIFY: %w", err)
+		}
+		settings.SkipVerify = skip
+	}
+
+	return settings, nil
 }
 
-func RegisterTlsConfig(pemPath, tlsConfigKey, serverName string) (err error) {
-	caCertPool := x509.NewCertPool()
-	pem, err := os.ReadFile(pemPath)
+// timeoutContext bounds ctx by the connection timeout of the environment,
+// or -wait when longer, unless it has a deadline already, the one of
+// SQL_MIGRATE_DEADLINE.
+func timeoutContext(ctx context.Context, env *Environment) (context.Context, context.CancelFunc) {
+	timeout := connectionTimeout(env)
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, max(timeout, Wait))
+}
+
+// connectionTimeout returns -timeout when given, else the timeout of the
+// environment, else the default of -timeout.
+func connectionTimeout(env *Environment) time.Duration {
+	if env.Timeout != nil && !flagGiven("timeout") {
+		return *env.Timeout
+	}
+	return Timeout
+}
+
+// connectRetries returns -connect-retries when given, else the
+// connectretries of the environment, else the default of -connect-retries.
+func connectRetries(env *Environment) int {
+	if env.ConnectRetries != nil && !flagGiven("connect-retries") {
+		return *env.ConnectRetries
+	}
+	return ConnectRetries
+}
+
+// retryBackoffOf returns the retrybackoff of the environment, fallback when
+// it doesn't set one.
+func retryBackoffOf(env *Environment, fallback time.Duration) time.Duration {
+	if env.RetryBackoff > 0 {
+		return env.RetryBackoff
+	}
+	return fallback
+}
+
+// flagGiven reports whether the common flag was passed explicitly.
+func flagGiven(name string) bool {
+	return configFlags != nil && isFlagSet(configFlags, name)
+}
+
+// pingWithRetry pings the database, retrying with exponential backoff so
+// that a database which is restarting gets a chance to come back.
+func pingWithRetry(ctx context.Context, db *sql.DB, timeout time.Duration, retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		err := ping(ctx, db, timeout)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+
+		ui.Warn(fmt.Sprintf("Cannot ping database (%s), retrying in %s", err, backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func ping(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return db.PingContext(ctx)
+}
+
+func RegisterTlsConfig(tlsConfigKey string, settings TlsSettings) error {
+	config, err := newTlsConfig(settings)
 	if err != nil {
-		return
+		return err
 	}
 
-	if ok := caCertPool.AppendCertsFromPEM(pem); !ok {
-		return fmt.Errorf("cannot append certs from PEM")
+	return mysql.RegisterTLSConfig(tlsConfigKey, config)
+}
+
+// caPem returns the CA certificates, given inline or read from a file. The
+// inline PEM takes precedence. Environment variables holding a PEM on a
+// single line may use \n for the line breaks.
+func caPem(settings TlsSettings) ([]byte, error) {
+	if settings.CAPem == "" {
+		return os.ReadFile(settings.CAFile)
 	}
+	if !strings.Contains(settings.CAPem, "\n") {
+		return []byte(strings.ReplaceAll(settings.CAPem, `\n`, "\n")), nil
+	}
+	return []byte(settings.CAPem), nil
+}
 
-	mysql.RegisterTLSConfig(tlsConfigKey, &tls.Config{
-		RootCAs:    caCertPool,
-		ServerName: serverName,
-	})
+// newTlsConfig builds a TLS config trusting the configured CA. The client
+// certificate is only loaded when a certificate or key file is set, for
+// servers that require mutual TLS.
+func newTlsConfig(settings TlsSettings) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.SkipVerify,
+	}
+
+	if settings.CAPem != "" || settings.CAFile != "" || !settings.SkipVerify {
+		caCertPool := x509.NewCertPool()
+		pem, err := caPem(settings)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok := caCertPool.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("cannot append certs from PEM")
+		}
+		config.RootCAs = caCertPool
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
 
-	return
+	return config, nil
 }
 
 // GetVersion returns the version.
@@ -153,6 +1629,111 @@ func GetVersion() string {
 	return "dev"
 }
 
+// GetVersionInfo returns the version along with the commit, build date and
+// Go version, as printed by -version.
+func GetVersionInfo() string {
+	buildInfo, _ := debug.ReadBuildInfo()
+	return formatVersionInfo(GetVersion(), buildInfo)
+}
+
+func formatVersionInfo(version string, buildInfo *debug.BuildInfo) string {
+	commit, date, modified := "unknown", "unknown", false
+	goVersion := runtime.Version()
+	if buildInfo != nil {
+		goVersion = buildInfo.GoVersion
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.time":
+				date = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if modified {
+		commit += " (modified)"
+	}
+
+	return fmt.Sprintf("sql-migrate %s\n  commit: %s\n  built:  %s\n  go:     %s", version, commit, date, goVersion)
+}
+
+// isTlsEnabled reports whether the MySQL data source requests the custom
+// TLS config registered from the MYSQL_* environment variables. The other
+// tls values (true, skip-verify, preferred) are handled by the driver.
+// Connections over a Unix socket never use TLS.
 func isTlsEnabled(env *Environment) bool {
-	return strings.Contains(env.DataSource, "tls=custom")
+	return !isMysqlSocket(env.DataSource) && mysqlParams(env.DataSource).Get("tls") == "custom"
+}
+
+// tlsConfigKey returns the key the custom TLS config of the environment is
+// registered under with the MySQL driver. It is named after the environment,
+// so that environments migrated in the same run with different CAs don't
+// replace each other's config.
+func tlsConfigKey(env *Environment) string {
+	return "custom-" + env.Name
+}
+
+// mysqlTlsDataSource makes the MySQL data source use the custom TLS config
+// registered under key: tls=custom is replaced by it, and it is added when
+// the data source doesn't set tls.
+func mysqlTlsDataSource(dataSource, key string) (string, error) {
+	param := "tls=" + url.QueryEscape(key)
+	switch tls := mysqlParams(dataSource).Get("tls"); tls {
+	case "custom":
+		// Replaced in place, the parameters are kept in order.
+		slash := strings.LastIndex(dataSource, "/")
+		base, query, _ := strings.Cut(dataSource[slash:], "?")
+		pairs := strings.Split(query, "&")
+		for i, pair := range pairs {
+			if name, _, _ := strings.Cut(pair, "="); name == "tls" {
+				pairs[i] = param
+			}
+		}
+		return dataSource[:slash] + base + "?" + strings.Join(pairs, "&"), nil
+	case "":
+	default:
+		return "", fmt.Errorf("The data source sets tls=%s, remove it to use the tls settings of the environment", tls)
+	}
+
+	if slash := strings.LastIndex(dataSource, "/"); slash >= 0 && strings.Contains(dataSource[slash:], "?") {
+		return dataSource + "&" + param, nil
+	}
+	return dataSource + "?" + param, nil
+}
+
+// isMysqlSocket reports whether the MySQL data source connects over a Unix
+// socket, with unix(/path/to/socket).
+func isMysqlSocket(dataSource string) bool {
+	// The parameters are left out, tls=custom can only be parsed once
+	// registered.
+	if slash := strings.LastIndex(dataSource, "/"); slash >= 0 {
+		dbName, _, _ := strings.Cut(dataSource[slash+1:], "?")
+		dataSource = dataSource[:slash+1] + dbName
+	}
+	cfg, err := mysql.ParseDSN(dataSource)
+	return err == nil && cfg.Net == "unix"
+}
+
+// mysqlParams returns the parameters of a MySQL data source. Like the driver,
+// they are taken from after the last slash so that a password containing
+// "?" or "&" is never mistaken for a parameter.
+//
+// mysql.ParseDSN cannot be used here: it rejects tls=custom until the
+// custom config has been registered.
+func mysqlParams(dataSource string) url.Values {
+	slash := strings.LastIndex(dataSource, "/")
+	if slash < 0 {
+		return url.Values{}
+	}
+
+	_, query, ok := strings.Cut(dataSource[slash+1:], "?")
+	if !ok {
+		return url.Values{}
+	}
+
+	// Malformed pairs are skipped, sql.Open will report them.
+	params, _ := url.ParseQuery(query)
+	return params
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CreateDatabase creates the database of the environment before migrating
+// when it doesn't exist, set with -create-db.
+var CreateDatabase bool
+
+// createDatabase connects to the maintenance database of the server, the
+// postgres database or none on MySQL, and creates the database named in
+// the data source of the environment unless it exists.
+func createDatabase(ctx context.Context, env *Environment) error {
+	var name, maintenance string
+	var err error
+	switch driverName(env.Dialect) {
+	case "postgres":
+		name, maintenance, err = postgresMaintenanceDataSource(env.DataSource)
+	case "mysql":
+		name, maintenance, err = mysqlMaintenanceDataSource(env.DataSource)
+	case "sqlite3":
+		// The file is created when opened.
+		return nil
+	default:
+		return fmt.Errorf("-create-db is not supported for dialect %s", env.Dialect)
+	}
+	if err != nil {
+		return err
+	}
+
+	server := *env
+	server.DataSource = maintenance
+	server.DisableCreateTable = false
+	db, dialect, err := GetConnectionContext(ctx, &server)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	created := false
+	if dialect == "postgres" {
+		if !postgresIdentifierRegex.MatchString(name) {
+			return fmt.Errorf("invalid database name %q", name)
+		}
+		var exists bool
+		if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+			return fmt.Errorf("cannot check database %s: %w", name, err)
+		}
+		if !exists {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE DATABASE "%s"`, name)); err != nil {
+				return fmt.Errorf("cannot create database %s: %w", name, err)
+			}
+			created = true
+		}
+	} else {
+		result, err := db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS `"+strings.ReplaceAll(name, "`", "``")+"`")
+		if err != nil {
+			return fmt.Errorf("cannot create database %s: %w", name, err)
+		}
+		// No row is affected when the database exists.
+		n, err := result.RowsAffected()
+		created = err == nil && n > 0
+	}
+
+	if created {
+		ui.Output(fmt.Sprintf("Created database %s", name))
+	}
+	return nil
+}
+
+// postgresMaintenanceDataSource returns the database named in a Postgres
+// data source, and the data source connecting to the postgres database of
+// the same server instead.
+func postgresMaintenanceDataSource(dataSource string) (string, string, error) {
+	if isPostgresURL(dataSource) {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return "", "", err
+		}
+		q := u.Query()
+		name := strings.TrimPrefix(u.Path, "/")
+		if q.Has("dbname") {
+			name = q.Get("dbname")
+			q.Del("dbname")
+			u.RawQuery = q.Encode()
+		}
+		if name == "" {
+			return "", "", errors.New("-create-db needs the data source to name the database")
+		}
+		u.Path = "/postgres"
+		u.RawPath = ""
+		return name, u.String(), nil
+	}
+
+	name, _ := postgresParam(dataSource, "dbname")
+	if name == "" {
+		return "", "", errors.New("-create-db needs the data source to name the database")
+	}
+	// The last dbname wins.
+	maintenance, err := addPostgresParam(dataSource, "dbname", "postgres")
+	return name, maintenance, err
+}
+
+// mysqlMaintenanceDataSource returns the database named in a MySQL data
+// source, and the data source connecting to the same server without
+// selecting a database.
+func mysqlMaintenanceDataSource(dataSource string) (string, string, error) {
+	slash := strings.LastIndex(dataSource, "/")
+	if slash < 0 {
+		return "", "", errors.New("-create-db needs the data source to name the database")
+	}
+	name, query, hasQuery := strings.Cut(dataSource[slash+1:], "?")
+	if name == "" {
+		return "", "", errors.New("-create-db needs the data source to name the database")
+	}
+	maintenance := dataSource[:slash+1]
+	if hasQuery {
+		maintenance += "?" + query
+	}
+	return name, maintenance, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// migrationDeadline returns the deadline given by SQL_MIGRATE_DEADLINE, as
+// an RFC3339 time or as a duration from now, such as the one left to a
+// Kubernetes Job.
+func migrationDeadline(now time.Time) (time.Time, bool, error) {
+	value := os.Getenv("SQL_MIGRATE_DEADLINE")
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	if deadline, err := time.Parse(time.RFC3339, value); err == nil {
+		return deadline, true, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid SQL_MIGRATE_DEADLINE %q, use an RFC3339 time or a positive duration such as 10m", value)
+}
@@ -0,0 +1,16 @@
+//go:build embed
+
+// Building with -tags embed compiles the migrations in the migrations
+// directory next to this file into the binary, so that it can run without
+// the migration files being present.
+package main
+
+import "embed"
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+func init() {
+	embeddedMigrations = &migrationsFS
+	defaultSource = "embed"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvFile is a .env file whose variables are available to the config file.
+var EnvFile string
+
+// loadEnvFile sets the variables of EnvFile in the process environment.
+// Variables that are already set keep their value, so that the real
+// environment takes precedence over the file.
+func loadEnvFile() error {
+	if EnvFile == "" {
+		return nil
+	}
+
+	vars, err := readEnvFile(EnvFile)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v[0]); ok {
+			continue
+		}
+		if err := os.Setenv(v[0], v[1]); err != nil {
+			return err
+		}
+	}
+
+	logger().Info("env file loaded", "file", EnvFile, "variables", len(vars))
+	return nil
+}
+
+// readEnvFile parses a .env file: KEY=value lines, optionally prefixed with
+// export, with blank lines and # comments ignored. Values can be quoted,
+// double quoted values understand the Go escape sequences, such as \n.
+// Variables are not expanded within the file.
+func readEnvFile(name string) ([][2]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", name, n)
+		}
+
+		value, err = envFileValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+func envFileValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 || !isEnvFileComment(value[end+1:]) {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'') + 1
+		if end == 0 || !isEnvFileComment(value[end+1:]) {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		return value[1:end], nil
+	}
+
+	// Unquoted values end at a comment, which must follow a space so that
+	// values such as passwords can hold a #.
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the quote ending the double quoted
+// value, skipping escaped quotes, or -1.
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// isEnvFileComment reports whether s, following a quoted value, is empty or
+// a comment.
+func isEnvFileComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type EnvFileSuite struct{}
+
+var _ = Suite(&EnvFileSuite{})
+
+func writeEnvFile(c *C, content string) string {
+	name := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(name, []byte(content), 0o600), IsNil)
+	return name
+}
+
+func (*EnvFileSuite) TestReadEnvFile(c *C) {
+	name := writeEnvFile(c, `
+# Local database
+DB_USER=app
+export DB_PASSWORD=s3cr#t # comment
+DB_HOST = localhost
+DB_NAME="my \"app\"\n" # comment
+DB_OPTIONS='sslmode=disable # kept'
+EMPTY=
+`)
+
+	vars, err := readEnvFile(name)
+	c.Assert(err, IsNil)
+	c.Assert(vars, DeepEquals, [][2]string{
+		{"DB_USER", "app"},
+		{"DB_PASSWORD", "s3cr#t"},
+		{"DB_HOST", "localhost"},
+		{"DB_NAME", "my \"app\"\n"},
+		{"DB_OPTIONS", "sslmode=disable # kept"},
+		{"EMPTY", ""},
+	})
+}
+
+func (*EnvFileSuite) TestReadEnvFileErrors(c *C) {
+	_, err := readEnvFile(writeEnvFile(c, "DB_USER=app\nDB_PASSWORD\n"))
+	c.Assert(err, ErrorMatches, `.*/\.env:2: expected KEY=value`)
+
+	_, err = readEnvFile(writeEnvFile(c, `DB_NAME="app`))
+	c.Assert(err, ErrorMatches, `.*/\.env:1: unterminated quoted value "app`)
+
+	_, err = readEnvFile(filepath.Join(c.MkDir(), ".env"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (*EnvFileSuite) TestLoadEnvFile(c *C) {
+	defer setenv("SQL_MIGRATE_TEST_USER", "from-env")()
+	defer setenv("SQL_MIGRATE_TEST_NAME", "")()
+	c.Assert(os.Unsetenv("SQL_MIGRATE_TEST_NAME"), IsNil)
+
+	EnvFile = writeEnvFile(c, "SQL_MIGRATE_TEST_USER=from-file\nSQL_MIGRATE_TEST_NAME=app\n")
+	defer func() { EnvFile = "" }()
+
+	c.Assert(loadEnvFile(), IsNil)
+	c.Assert(os.Getenv("SQL_MIGRATE_TEST_USER"), Equals, "from-env")
+	c.Assert(os.Getenv("SQL_MIGRATE_TEST_NAME"), Equals, "app")
+}
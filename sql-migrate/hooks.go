@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// hook is an entry of the before or after setting of an environment, run
+// in a transaction of its own around the migrations of up and down.
+type hook struct {
+	// name is the file of the hook, or its statement as logged.
+	name       string
+	statements []string
+}
+
+// loadHooks reads the hooks of an environment. An entry ending in .sql is a
+// file, split into statements like the Up section of a migration, any other
+// entry is a statement.
+func loadHooks(entries []string) ([]hook, error) {
+	hooks := make([]hook, 0, len(entries))
+	for _, entry := range entries {
+		if !isHookFile(entry) {
+			hooks = append(hooks, hook{name: loggedStatement(entry), statements: []string{entry}})
+			continue
+		}
+
+		content, err := os.ReadFile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read hook: %w", err)
+		}
+		parsed, err := sqlparse.ParseMigration(strings.NewReader("-- +migrate Up\n" + string(content)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse hook %s: %w", entry, err)
+		}
+		hooks = append(hooks, hook{name: entry, statements: parsed.UpStatements})
+	}
+	return hooks, nil
+}
+
+func isHookFile(entry string) bool {
+	return strings.HasSuffix(entry, ".sql") && !strings.ContainsAny(entry, " \t\n")
+}
+
+// hookSet holds the before and after hooks of a run.
+type hookSet struct {
+	before []hook
+	after  []hook
+}
+
+// loadHookSet reads the hooks of the environment, or returns nil when it has
+// none.
+func loadHookSet(env *Environment) (*hookSet, error) {
+	if len(env.Before) == 0 && len(env.After) == 0 {
+		return nil, nil
+	}
+	before, err := loadHooks(env.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := loadHooks(env.After)
+	if err != nil {
+		return nil, err
+	}
+	return &hookSet{before: before, after: after}, nil
+}
+
+// pinConnection limits the pool to a single connection, kept open for the
+// whole run, so that the session settings of the before hooks apply to the
+// migrations. The lock of the run holds a connection of its own.
+func (h *hookSet) pinConnection(db *sql.DB) {
+	if h == nil {
+		return
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+}
+
+// runBefore runs the before hooks, stopping at the first one that fails,
+// which is rolled back. The after hooks then run when earlier before hooks
+// were committed, to undo them.
+func (h *hookSet) runBefore(ctx context.Context, db *sql.DB) error {
+	if h == nil {
+		return nil
+	}
+	ran, err := runHooks(ctx, db, "before", h.before)
+	if err == nil {
+		return nil
+	}
+	if ran > 0 {
+		if err := h.runAfter(ctx, db); err != nil {
+			ui.Warn(err.Error())
+		}
+	}
+	return fmt.Errorf("%w, no migration was applied", err)
+}
+
+// runAfter runs the after hooks, even when the run was interrupted, to undo
+// what the before hooks did.
+func (h *hookSet) runAfter(ctx context.Context, db *sql.DB) error {
+	if h == nil {
+		return nil
+	}
+	_, err := runHooks(context.WithoutCancel(ctx), db, "after", h.after)
+	return err
+}
+
+// runHooks runs the before or after hooks, named by kind, stopping at the
+// first one that fails, which is rolled back. It returns the number of hooks
+// that were committed.
+func runHooks(ctx context.Context, db *sql.DB, kind string, hooks []hook) (int, error) {
+	for i, h := range hooks {
+		start := time.Now()
+		if err := runHook(ctx, db, h); err != nil {
+			return i, fmt.Errorf("The %s hook %s failed: %w", kind, h.name, err)
+		}
+		ui.Output(fmt.Sprintf("Ran %s hook %s", kind, h.name))
+		logger().Info("hook executed", "hook", kind, "name", h.name, "duration", time.Since(start))
+	}
+	return len(hooks), nil
+}
+
+func runHook(ctx context.Context, db *sql.DB, h hook) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range h.statements {
+		if _, err := tx.ExecContext(ctx, trimStatement(stmt)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestLoadHooks(c *C) {
+	file := filepath.Join(c.MkDir(), "triggers.sql")
+	c.Assert(os.WriteFile(file, []byte("ALTER TABLE people DISABLE TRIGGER ALL;\nALTER TABLE pets DISABLE TRIGGER ALL;\n"), 0o644), IsNil)
+
+	hooks, err := loadHooks([]string{"SET  session_replication_role =\n replica", file})
+	c.Assert(err, IsNil)
+	c.Assert(hooks, HasLen, 2)
+	c.Assert(hooks[0].name, Equals, "SET session_replication_role = replica")
+	c.Assert(hooks[0].statements, DeepEquals, []string{"SET  session_replication_role =\n replica"})
+	c.Assert(hooks[1].name, Equals, file)
+	c.Assert(hooks[1].statements, HasLen, 2)
+
+	_, err = loadHooks([]string{filepath.Join(c.MkDir(), "missing.sql")})
+	c.Assert(err, ErrorMatches, "cannot read hook: .*missing.sql: no such file or directory")
+}
+
+func (*ConfigSuite) TestApplyMigrationsHooks(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_insert.sql"), []byte("-- +migrate Up\nINSERT INTO session_ids (id) VALUES (1);\n-- +migrate Down\n"), 0o644), IsNil)
+	config := `
+development:
+  dialect: sqlite3
+  datasource: ` + filepath.Join(c.MkDir(), "test.db") + `
+  dir: ` + dir + `
+  maxidleconns: -1
+  before:
+    - CREATE TEMP TABLE session_ids (id int)
+  after:
+`
+	// A temporary table only exists on the connection that created it, which
+	// is kept for the migrations despite maxidleconns.
+	writeConfig(c, config+"    - DROP TABLE session_ids\n")
+	n, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(mock.OutputWriter.String(), Equals, "Ran before hook CREATE TEMP TABLE session_ids (id int)\nRan after hook DROP TABLE session_ids\nApplied 1 migration\n")
+
+	writeConfig(c, config+"    - DROP TABLE session_ids\n    - SELECT id FROM missing\n")
+	_, err = ApplyMigrations(context.Background(), migrate.Down, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "The after hook SELECT id FROM missing failed: no such table: missing, the migrations applied are kept")
+
+	writeConfig(c, config+"    - DROP TABLE session_ids\n")
+	mock.OutputWriter.Reset()
+	c.Assert(os.WriteFile(filepath.Join(dir, "2_fail.sql"), []byte("-- +migrate Up\nINSERT INTO missing (id) VALUES (1);\n"), 0o644), IsNil)
+	_, err = ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "Migration failed: .*no such table: missing.*")
+	c.Assert(mock.OutputWriter.String(), Matches, "(?s).*Ran after hook DROP TABLE session_ids\n")
+}
+
+func (*ConfigSuite) TestApplyMigrationsBeforeHookFails(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+  before:
+    - SELECT id FROM missing
+`)
+	_, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "The before hook SELECT id FROM missing failed: no such table: missing, no migration was applied")
+
+	// The after hooks undo the before hooks that were committed.
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+	datasource := filepath.Join(c.MkDir(), "test.db")
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+datasource+`
+  dir: ../test-migrations
+  before:
+    - CREATE TABLE hook_marker (id int)
+    - SELECT id FROM missing
+  after:
+    - DROP TABLE hook_marker
+`)
+	_, err = ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "The before hook SELECT id FROM missing failed: no such table: missing, no migration was applied")
+	c.Assert(mock.OutputWriter.String(), Equals, "Ran before hook CREATE TABLE hook_marker (id int)\nRan after hook DROP TABLE hook_marker\n")
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	var n int
+	c.Assert(db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'hook_marker'").Scan(&n), IsNil)
+	c.Assert(n, Equals, 0)
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  after:
+    - " "
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "before and after cannot contain an empty hook")
+}
+
+func (*ConfigSuite) TestRedoAndApplyHooks(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_insert.sql"), []byte("-- +migrate Up\nINSERT INTO session_ids (id) VALUES (1);\n-- +migrate Down\nDELETE FROM session_ids;\n"), 0o644), IsNil)
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: `+dir+`
+  maxidleconns: -1
+  before:
+    - CREATE TEMP TABLE session_ids (id int)
+  after:
+    - DROP TABLE session_ids
+`)
+	configFile := ConfigFile
+
+	c.Assert(ApplyMigration(context.Background(), "1_insert.sql", migrate.Up, false, false), IsNil)
+	c.Assert(mock.OutputWriter.String(), Equals, "Ran before hook CREATE TEMP TABLE session_ids (id int)\nRan after hook DROP TABLE session_ids\nApplied migration 1_insert.sql\n")
+
+	mock.OutputWriter.Reset()
+	c.Assert((&RedoCommand{}).Run([]string{"-config", configFile}), Equals, 0)
+	c.Assert(mock.OutputWriter.String(), Equals, "Ran before hook CREATE TEMP TABLE session_ids (id int)\nRan after hook DROP TABLE session_ids\nReapplied migration 1_insert.sql.\n")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// LockTimeout is how long to wait for another migration run to release the
+// migration lock, 0 waits as long as needed.
+var LockTimeout time.Duration
+
+// lockRetryInterval is how often a Postgres lock held by another run is
+// tried again.
+var lockRetryInterval = 500 * time.Millisecond
+
+// migrationLockName identifies the migration table in the lock, so that runs
+// against different tables of the same database don't wait for each other.
+func migrationLockName(env *Environment) string {
+	return "sql-migrate:" + qualifiedMigrationTableName(env)
+}
+
+// postgresLockKey returns the key of the advisory lock, derived from the
+// migration table.
+func postgresLockKey(env *Environment) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(migrationLockName(env)))
+	return int64(h.Sum64())
+}
+
+// mysqlLockName returns the name of the lock, which MySQL limits to 64
+// characters: longer ones are replaced by a hash.
+func mysqlLockName(env *Environment) string {
+	name := migrationLockName(env)
+	if len(name) > 64 {
+		name = fmt.Sprintf("sql-migrate:%016x", uint64(postgresLockKey(env)))
+	}
+	return name
+}
+
+// lockMigrations takes a lock on the migration table for the duration of a
+// run, so that concurrent runs, such as two deploys, don't apply the same
+// migrations: an advisory lock on Postgres, a named lock on MySQL, or the
+// lock table with lock: table. Other dialects are not locked by default. The
+// advisory locks belong to a dedicated connection, the returned function
+// releases them.
+func lockMigrations(ctx context.Context, db *sql.DB, env *Environment) (func(), error) {
+	if env.Lock == "table" {
+		return lockWithTable(ctx, db, env)
+	}
+
+	dialect := driverName(env.Dialect)
+	if dialect != "postgres" && dialect != "mysql" {
+		return func() {}, nil
+	}
+
+	// The lock connection doesn't count towards maxopenconns, which would
+	// leave no connection for the migrations with maxopenconns: 1.
+	if max := db.Stats().MaxOpenConnections; max > 0 {
+		db.SetMaxOpenConns(max + 1)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var unlock func() error
+	if dialect == "postgres" {
+		key := postgresLockKey(env)
+		err = lockPostgres(ctx, conn, key)
+		unlock = func() error {
+			_, err := conn.ExecContext(context.Background(), fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key))
+			return err
+		}
+	} else {
+		name := mysqlLockName(env)
+		err = lockMysql(ctx, conn, name)
+		unlock = func() error {
+			_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+			return err
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	logger().Info("migration lock acquired", "lock", migrationLockName(env), "duration", time.Since(start))
+
+	return func() {
+		if err := unlock(); err != nil {
+			logger().Warn("cannot release the migration lock", "error", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+func lockPostgres(ctx context.Context, conn *sql.Conn, key int64) error {
+	query := fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key)
+	var deadline time.Time
+	if LockTimeout > 0 {
+		deadline = time.Now().Add(LockTimeout)
+	}
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, query).Scan(&locked); err != nil {
+			return fmt.Errorf("cannot lock the migration table: %w", err)
+		}
+		if locked {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return errLocked()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func lockMysql(ctx context.Context, conn *sql.Conn, name string) error {
+	// GET_LOCK waits for up to the given number of seconds, forever when
+	// negative.
+	seconds := -1.0
+	if LockTimeout > 0 {
+		seconds = math.Ceil(LockTimeout.Seconds())
+	}
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&locked); err != nil {
+		return fmt.Errorf("cannot lock the migration table: %w", err)
+	}
+	if !locked.Valid {
+		return fmt.Errorf("cannot lock the migration table %s", name)
+	}
+	if locked.Int64 != 1 {
+		return errLocked()
+	}
+	return nil
+}
+
+func errLocked() error {
+	return fmt.Errorf("Another migration is in progress, the migration lock was not released within %s (-lock-timeout)", LockTimeout)
+}
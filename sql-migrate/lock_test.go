@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type LockSuite struct{}
+
+var _ = Suite(&LockSuite{})
+
+func (*LockSuite) TearDownTest(*C) {
+	LockTimeout = 0
+	ForceUnlock = false
+	lockRetryInterval = 500 * time.Millisecond
+}
+
+func (*LockSuite) TestLockNames(c *C) {
+	env := &Environment{Dialect: "mysql", TableName: "migrations"}
+	c.Assert(mysqlLockName(env), Equals, "sql-migrate:migrations")
+
+	env.SchemaName = "tenant"
+	c.Assert(mysqlLockName(env), Equals, "sql-migrate:tenant.migrations")
+	c.Assert(postgresLockKey(env), Not(Equals), postgresLockKey(&Environment{TableName: "migrations"}))
+
+	env.TableName = strings.Repeat("m", 60)
+	c.Assert(mysqlLockName(env), Matches, "sql-migrate:[0-9a-f]{16}")
+}
+
+func (*LockSuite) TestLockMigrationsPostgres(c *C) {
+	ConnectRetries = 0
+	env := &Environment{Dialect: "postgres", TableName: "lock_migrations"}
+	query := fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", postgresLockKey(env))
+
+	free := c.MkDir()
+	servePostgresSocketResults(c, filepath.Join(free, ".s.PGSQL.5432"), map[string]string{query: "t"})
+	env.DataSource = fmt.Sprintf("host=%s dbname=test user=test", free)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	unlock, err := lockMigrations(context.Background(), db, env)
+	c.Assert(err, IsNil)
+	unlock()
+	c.Assert(db.Close(), IsNil)
+
+	held := c.MkDir()
+	servePostgresSocketResults(c, filepath.Join(held, ".s.PGSQL.5432"), map[string]string{query: "f"})
+	env.DataSource = fmt.Sprintf("host=%s dbname=test user=test", held)
+	db, _, err = GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	LockTimeout = 20 * time.Millisecond
+	lockRetryInterval = 5 * time.Millisecond
+	_, err = lockMigrations(context.Background(), db, env)
+	c.Assert(err, ErrorMatches, `Another migration is in progress, the migration lock was not released within 20ms \(-lock-timeout\)`)
+}
+
+func (*LockSuite) TestLockMigrationsOtherDialects(c *C) {
+	// Nothing to lock, the database is not even used.
+	unlock, err := lockMigrations(context.Background(), nil, &Environment{Dialect: "sqlite3"})
+	c.Assert(err, IsNil)
+	unlock()
+}
+
+func (*LockSuite) TestLockWithTable(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	env := &Environment{Dialect: "sqlite3", DataSource: filepath.Join(c.MkDir(), "test.db"), TableName: "table_migrations", Lock: "table"}
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	unlock, err := lockMigrations(context.Background(), db, env)
+	c.Assert(err, IsNil)
+	var owner string
+	c.Assert(db.QueryRow("SELECT owner FROM table_migrations_lock WHERE id = 1").Scan(&owner), IsNil)
+	c.Assert(owner, Equals, lockOwner())
+
+	// Held by this run.
+	LockTimeout = 20 * time.Millisecond
+	lockRetryInterval = 5 * time.Millisecond
+	_, err = lockMigrations(context.Background(), db, env)
+	c.Assert(err, ErrorMatches, `Another migration is in progress, the migration lock held by .* since .* was not released within 20ms \(-lock-timeout\)`)
+
+	unlock()
+	unlock, err = lockMigrations(context.Background(), db, env)
+	c.Assert(err, IsNil)
+	unlock()
+
+	// Left behind by a run that was killed.
+	_, err = db.Exec("INSERT INTO table_migrations_lock (id, owner, locked_at) VALUES (1, 'build:42', ?)", time.Now().Add(-2*time.Hour).UTC())
+	c.Assert(err, IsNil)
+	_, err = lockMigrations(context.Background(), db, env)
+	c.Assert(err, ErrorMatches, `The migration lock held by build:42 since .* is older than 1h0m0s \(lockttl\), pass -force-unlock to break it`)
+
+	ForceUnlock = true
+	unlock, err = lockMigrations(context.Background(), db, env)
+	c.Assert(err, IsNil)
+	unlock()
+	c.Assert(mock.ErrorWriter.String(), Matches, "Breaking the migration lock held by build:42 since .*\n")
+}
+
+func (*ConfigSuite) TestGetEnvironmentLock(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  lock: table
+  lockttl: 10m
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.LockTTL, Equals, 10*time.Minute)
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  lock: row
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, `Unknown lock "row", use advisory or table`)
+
+	writeConfig(c, `
+development:
+  dialect: postgres
+  datasource: postgres://localhost/app
+  lockttl: 10m
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "lockttl needs lock: table")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+)
+
+// ForceUnlock breaks a lock table entry older than the lockttl of the
+// environment, left behind by a run that didn't exit cleanly.
+var ForceUnlock bool
+
+// defaultLockTTL is the age after which a lock table entry can be broken
+// when the environment doesn't set lockttl.
+const defaultLockTTL = time.Hour
+
+// lockRecord is the row of the lock table, there is at most one.
+type lockRecord struct {
+	Id       int       `db:"id"`
+	Owner    string    `db:"owner"`
+	LockedAt time.Time `db:"locked_at"`
+}
+
+// lockTableName returns the name of the lock table, next to the migration
+// table.
+func lockTableName(env *Environment) string {
+	return migrationTableName(env) + "_lock"
+}
+
+// lockOwner identifies the run holding the lock table entry.
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// lockWithTable takes the lock by inserting the single row of the lock
+// table, which fails while another run holds it. Unlike the advisory locks,
+// the row outlives a run that is killed, it is then broken with
+// -force-unlock once older than the lockttl of the environment.
+func lockWithTable(ctx context.Context, db *sql.DB, env *Environment) (func(), error) {
+	dialect := environmentDialect(env)
+	dbMap := &gorp.DbMap{Db: db, Dialect: dialect}
+	dbMap.AddTableWithNameAndSchema(lockRecord{}, env.SchemaName, lockTableName(env)).SetKeys(false, "Id")
+	if !env.DisableCreateTable {
+		if err := dbMap.CreateTablesIfNotExists(); err != nil {
+			return nil, fmt.Errorf("cannot create the lock table: %w", err)
+		}
+	}
+
+	table := dialect.QuotedTableForQuery(env.SchemaName, lockTableName(env))
+	release := fmt.Sprintf("DELETE FROM %s WHERE id = %s AND owner = %s", table, dialect.BindVar(0), dialect.BindVar(1))
+	owner := lockOwner()
+	ttl := env.LockTTL
+	if ttl == 0 {
+		ttl = defaultLockTTL
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if LockTimeout > 0 {
+		deadline = start.Add(LockTimeout)
+	}
+	released := false
+	for {
+		err := dbMap.WithContext(ctx).Insert(&lockRecord{Id: 1, Owner: owner, LockedAt: time.Now().UTC()})
+		if err == nil {
+			break
+		}
+
+		held, getErr := dbMap.WithContext(ctx).Get(lockRecord{}, 1)
+		if getErr != nil {
+			return nil, fmt.Errorf("cannot lock the migration table: %w", getErr)
+		}
+		if held == nil {
+			// Released since the insert, unless the insert failed for
+			// another reason.
+			if released {
+				return nil, fmt.Errorf("cannot lock the migration table: %w", err)
+			}
+			released = true
+			continue
+		}
+		released = false
+
+		record := held.(*lockRecord)
+		since := record.LockedAt.UTC().Format(time.RFC3339)
+		if time.Since(record.LockedAt) > ttl {
+			if !ForceUnlock {
+				return nil, fmt.Errorf("The migration lock held by %s since %s is older than %s (lockttl), pass -force-unlock to break it", record.Owner, since, ttl)
+			}
+			ui.Warn(fmt.Sprintf("Breaking the migration lock held by %s since %s", record.Owner, since))
+			if _, err := db.ExecContext(ctx, release, 1, record.Owner); err != nil {
+				return nil, fmt.Errorf("cannot break the migration lock: %w", err)
+			}
+			continue
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, fmt.Errorf("Another migration is in progress, the migration lock held by %s since %s was not released within %s (-lock-timeout)", record.Owner, since, LockTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	logger().Info("migration lock acquired", "lock", qualifiedMigrationTableName(env)+"_lock", "duration", time.Since(start))
+
+	return func() {
+		if _, err := db.ExecContext(context.Background(), release, 1, owner); err != nil {
+			logger().Warn("cannot release the migration lock", "error", err)
+		}
+	}, nil
+}
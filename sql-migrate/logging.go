@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+var (
+	Verbose   bool
+	LogFormat string
+)
+
+// VerboseSql logs each statement of the migrations as it runs, even without
+// -v.
+var VerboseSql bool
+
+// maxLoggedStatement is the length statements are truncated to in the log.
+const maxLoggedStatement = 200
+
+// credentialLiteral matches the string literals of statements that likely
+// hold a credential, such as CREATE USER ... PASSWORD '...', urlPassword the
+// passwords of URLs.
+var (
+	credentialLiteral = regexp.MustCompile(`(?i)(\b(?:password|secret|token|identified(?:\s+with\s+\w+)?\s+by)(?:\s*=\s*|\s+))'(?:[^']|'')*'`)
+	urlPassword       = regexp.MustCompile(`(://[^:/@\s']*:)[^@\s']*@`)
+)
+
+// logOutput is where the log is written, stderr keeps it apart from the
+// regular output.
+var logOutput io.Writer = os.Stderr
+
+func logFlags(f *flag.FlagSet) {
+	LogFormat = "text"
+	f.BoolVar(&Verbose, "v", false, "Log each step.")
+	f.BoolVar(&Verbose, "verbose", false, "Log each step.")
+	f.Func("log-format", "Format of the log, text or json.", func(value string) error {
+		if value != "text" && value != "json" {
+			return fmt.Errorf("unknown log format %q, use text or json", value)
+		}
+		LogFormat = value
+		return nil
+	})
+}
+
+// logger returns the logger configured by the -v and -log-format flags.
+// Nothing is logged without -v. Data sources must always be passed through
+// MaskDataSource before being logged.
+func logger() *slog.Logger {
+	return newLogger(Verbose)
+}
+
+func newLogger(enabled bool) *slog.Logger {
+	if !enabled {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(logOutput, nil))
+	}
+	return slog.New(slog.NewTextHandler(logOutput, nil))
+}
+
+func logMigrationApplied(migration *migrate.PlannedMigration, dir migrate.MigrationDirection, duration time.Duration) {
+	logger().Info("migration applied", "id", migration.Id, "direction", directionName(dir), "duration", duration)
+}
+
+func logStatementStarted(migration *migrate.PlannedMigration, statement string) {
+	if VerboseSql {
+		newLogger(true).Info("statement started", "id", migration.Id, "statement", loggedStatement(statement))
+	}
+}
+
+func logStatementExecuted(migration *migrate.PlannedMigration, statement string, duration time.Duration, err error) {
+	if !VerboseSql {
+		return
+	}
+	if err != nil {
+		newLogger(true).Warn("statement failed", "id", migration.Id, "duration", duration, "error", err)
+		return
+	}
+	newLogger(true).Info("statement executed", "id", migration.Id, "duration", duration)
+}
+
+// loggedStatement returns a statement the way it is logged: on one line,
+// with the literals looking like credentials masked, and truncated.
+func loggedStatement(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+	statement = credentialLiteral.ReplaceAllString(statement, "$1'***'")
+	statement = urlPassword.ReplaceAllString(statement, "${1}***@")
+	if runes := []rune(statement); len(runes) > maxLoggedStatement {
+		statement = string(runes[:maxLoggedStatement]) + "..."
+	}
+	return statement
+}
+
+func directionName(dir migrate.MigrationDirection) string {
+	if dir == migrate.Down {
+		return "down"
+	}
+	return "up"
+}
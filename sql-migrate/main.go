@@ -14,7 +14,8 @@ func main() {
 var ui cli.Ui
 
 func realMain() int {
-	ui = &cli.BasicUi{Writer: os.Stdout, ErrorWriter: os.Stderr}
+	ui = newUi()
+	defer closeSshTunnels()
 
 	cli := &cli.CLI{
 		Args: os.Args[1:],
@@ -25,23 +26,53 @@ func realMain() int {
 			"down": func() (cli.Command, error) {
 				return &DownCommand{}, nil
 			},
+			"apply": func() (cli.Command, error) {
+				return &ApplyCommand{}, nil
+			},
+			"diff": func() (cli.Command, error) {
+				return &DiffCommand{}, nil
+			},
+			"doctor": func() (cli.Command, error) {
+				return &DoctorCommand{}, nil
+			},
+			"environments": func() (cli.Command, error) {
+				return &EnvironmentsCommand{}, nil
+			},
 			"redo": func() (cli.Command, error) {
 				return &RedoCommand{}, nil
 			},
 			"status": func() (cli.Command, error) {
 				return &StatusCommand{}, nil
 			},
+			"orphans": func() (cli.Command, error) {
+				return &OrphansCommand{}, nil
+			},
+			"pending": func() (cli.Command, error) {
+				return &PendingCommand{}, nil
+			},
+			"history": func() (cli.Command, error) {
+				return &HistoryCommand{}, nil
+			},
+			"init": func() (cli.Command, error) {
+				return &InitCommand{}, nil
+			},
 			"new": func() (cli.Command, error) {
 				return &NewCommand{}, nil
 			},
 			"skip": func() (cli.Command, error) {
 				return &SkipCommand{}, nil
 			},
+			"validate": func() (cli.Command, error) {
+				return &ValidateCommand{}, nil
+			},
+			"verify": func() (cli.Command, error) {
+				return &VerifyCommand{}, nil
+			},
 		},
 		HelpFunc:    cli.BasicHelpFunc("sql-migrate"),
 		HelpWriter:  os.Stdout,
 		ErrorWriter: os.Stderr,
-		Version:     GetVersion(),
+		Version:     version(os.Args[1:]),
 	}
 
 	exitCode, err := cli.Run()
@@ -52,3 +83,18 @@ func realMain() int {
 
 	return exitCode
 }
+
+// version returns the text printed by -version, only the version itself
+// when --short is passed as well.
+func version(args []string) string {
+	for _, arg := range args {
+		if arg == "-short" || arg == "--short" {
+			return GetVersion()
+		}
+		if arg != "" && arg[0] != '-' {
+			// Flags of a subcommand.
+			break
+		}
+	}
+	return GetVersionInfo()
+}
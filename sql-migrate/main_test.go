@@ -1 +1,62 @@
 package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	ui = cli.NewMockUi()
+	TestingT(t)
+}
+
+func (*ConfigSuite) TestCommandFlags(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	// The flag package reports the unknown flags on stderr.
+	defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+	devNull, err := os.Open(os.DevNull)
+	c.Assert(err, IsNil)
+	defer devNull.Close()
+	os.Stderr = devNull
+
+	missing := filepath.Join(c.MkDir(), "dbconfig.yml")
+	for _, t := range []struct {
+		command    cli.Command
+		flag       string
+		registered bool
+	}{
+		{&UpCommand{}, "-yes", true},
+		{&UpCommand{}, "-print-dsn", true},
+		{&SkipCommand{}, "-non-interactive", true},
+		{&StatusCommand{}, "-yes", false},
+		{&StatusCommand{}, "-quiet", false},
+		{&StatusCommand{}, "-template", true},
+		{&PendingCommand{}, "-quiet", true},
+		{&HistoryCommand{}, "-template", false},
+		{&ValidateCommand{}, "-print-dsn", false},
+		{&ValidateCommand{}, "-aws-profile=admin", true},
+		{&NewCommand{}, "-aws-profile=admin", false},
+		{&EnvironmentsCommand{}, "-quiet", false},
+		{&EnvironmentsCommand{}, "-env=staging", false},
+		{&NewCommand{}, "-dialect=sqlite3", false},
+		{&NewCommand{}, "-timeout=1s", false},
+		{&NewCommand{}, "-env-file=.env", true},
+		{&DiffCommand{}, "-env=staging", false},
+		{&DiffCommand{}, "-timeout=1s", true},
+	} {
+		mock := cli.NewMockUi()
+		ui = mock
+		c.Assert(t.command.Run([]string{t.flag, "-config", missing}), Equals, 1)
+		// An unknown flag prints the help.
+		c.Check(strings.Contains(mock.OutputWriter.String(), "Usage:"), Equals, !t.registered, Commentf("%T %s", t.command, t.flag))
+		listed := regexp.MustCompile(`\s` + strings.Split(t.flag, "=")[0] + `[=\s]`).MatchString(t.command.Help())
+		c.Check(listed, Equals, t.registered, Commentf("%T %s", t.command, t.flag))
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// MetricsFile is where up, down and redo write their timings, in the
+// Prometheus text format read by the node_exporter textfile collector.
+var MetricsFile string
+
+type migrationMetric struct {
+	Id        string
+	Direction string
+	Duration  time.Duration
+	Failed    bool
+}
+
+// runMetrics collects the timings of the migrations applied by a command.
+type runMetrics struct {
+	command    string
+	start      time.Time
+	last       time.Time
+	migrations []migrationMetric
+}
+
+func newRunMetrics(command string) *runMetrics {
+	now := time.Now()
+	return &runMetrics{command: command, start: now, last: now}
+}
+
+// applied is called by the migrate package after each applied migration.
+func (r *runMetrics) applied(migration *migrate.PlannedMigration, dir migrate.MigrationDirection, duration time.Duration) {
+	logMigrationApplied(migration, dir, duration)
+	r.migrations = append(r.migrations, migrationMetric{Id: migration.Id, Direction: directionName(dir), Duration: duration})
+	r.last = time.Now()
+}
+
+// failed records the migration that caused err, if any. The migrate package
+// does not time failed migrations, they are timed from the end of the
+// previous one instead.
+func (r *runMetrics) failed(dir migrate.MigrationDirection, err error) {
+	var txErr *migrate.TxError
+	if !errors.As(err, &txErr) {
+		return
+	}
+
+	duration := time.Since(r.last)
+	logger().Error("migration failed", "id", txErr.Migration.Id, "direction", directionName(dir), "duration", duration, "error", txErr.Err)
+	r.migrations = append(r.migrations, migrationMetric{Id: txErr.Migration.Id, Direction: directionName(dir), Duration: duration, Failed: true})
+}
+
+// write stores the metrics in MetricsFile, when set. The file is replaced
+// atomically, so that the collector never reads a partial file.
+func (r *runMetrics) write(success bool) error {
+	if MetricsFile == "" {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(MetricsFile), ".sql-migrate-*.prom")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.WriteString(r.format(success, time.Now())); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), MetricsFile)
+}
+
+func (r *runMetrics) format(success bool, now time.Time) string {
+	var b strings.Builder
+
+	b.WriteString("# HELP sql_migrate_migration_duration_seconds Duration of each migration applied by the last run.\n")
+	b.WriteString("# TYPE sql_migrate_migration_duration_seconds gauge\n")
+	for _, m := range r.migrations {
+		fmt.Fprintf(&b, "sql_migrate_migration_duration_seconds{environment=%s,id=%s,direction=%s,status=%s} %g\n",
+			promLabel(ConfigEnvironment), promLabel(m.Id), promLabel(m.Direction), promLabel(status(!m.Failed)), m.Duration.Seconds())
+	}
+
+	labels := fmt.Sprintf("{environment=%s,command=%s,status=%s}", promLabel(ConfigEnvironment), promLabel(r.command), promLabel(status(success)))
+	applied := 0
+	for _, m := range r.migrations {
+		if !m.Failed {
+			applied++
+		}
+	}
+
+	b.WriteString("# HELP sql_migrate_run_duration_seconds Total duration of the last run.\n")
+	b.WriteString("# TYPE sql_migrate_run_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "sql_migrate_run_duration_seconds%s %g\n", labels, now.Sub(r.start).Seconds())
+	b.WriteString("# HELP sql_migrate_run_migrations Number of migrations applied by the last run.\n")
+	b.WriteString("# TYPE sql_migrate_run_migrations gauge\n")
+	fmt.Fprintf(&b, "sql_migrate_run_migrations%s %d\n", labels, applied)
+	b.WriteString("# HELP sql_migrate_run_timestamp_seconds Time the last run finished.\n")
+	b.WriteString("# TYPE sql_migrate_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "sql_migrate_run_timestamp_seconds%s %d\n", labels, now.Unix())
+
+	return b.String()
+}
+
+func status(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(value string) string {
+	return `"` + promLabelEscaper.Replace(value) + `"`
+}
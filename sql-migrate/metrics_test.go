@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type MetricsSuite struct {
+	configEnvironment string
+}
+
+var _ = Suite(&MetricsSuite{})
+
+func (s *MetricsSuite) SetUpTest(*C) {
+	s.configEnvironment = ConfigEnvironment
+	ConfigEnvironment = "production"
+}
+
+func (s *MetricsSuite) TearDownTest(*C) {
+	ConfigEnvironment = s.configEnvironment
+	MetricsFile = ""
+}
+
+func (*MetricsSuite) TestRecord(c *C) {
+	run := newRunMetrics("up")
+	run.applied(&migrate.PlannedMigration{Migration: &migrate.Migration{Id: "1_initial.sql"}}, migrate.Up, time.Second)
+	run.failed(migrate.Up, errors.New("cannot plan"))
+	run.failed(migrate.Up, &migrate.TxError{Migration: &migrate.Migration{Id: "2_record.sql"}, Err: errors.New("syntax error")})
+
+	c.Assert(run.migrations, HasLen, 2)
+	c.Assert(run.migrations[0], DeepEquals, migrationMetric{Id: "1_initial.sql", Direction: "up", Duration: time.Second})
+	c.Assert(run.migrations[1].Id, Equals, "2_record.sql")
+	c.Assert(run.migrations[1].Failed, Equals, true)
+}
+
+func (*MetricsSuite) TestFormat(c *C) {
+	start := time.Unix(1700000000, 0)
+	run := &runMetrics{command: "down", start: start, migrations: []migrationMetric{
+		{Id: "2_record.sql", Direction: "down", Duration: 1500 * time.Millisecond},
+		{Id: `1_"initial".sql`, Direction: "down", Duration: 250 * time.Millisecond, Failed: true},
+	}}
+
+	c.Assert(run.format(false, start.Add(3*time.Second)), Equals, `# HELP sql_migrate_migration_duration_seconds Duration of each migration applied by the last run.
+# TYPE sql_migrate_migration_duration_seconds gauge
+sql_migrate_migration_duration_seconds{environment="production",id="2_record.sql",direction="down",status="success"} 1.5
+sql_migrate_migration_duration_seconds{environment="production",id="1_\"initial\".sql",direction="down",status="failure"} 0.25
+# HELP sql_migrate_run_duration_seconds Total duration of the last run.
+# TYPE sql_migrate_run_duration_seconds gauge
+sql_migrate_run_duration_seconds{environment="production",command="down",status="failure"} 3
+# HELP sql_migrate_run_migrations Number of migrations applied by the last run.
+# TYPE sql_migrate_run_migrations gauge
+sql_migrate_run_migrations{environment="production",command="down",status="failure"} 1
+# HELP sql_migrate_run_timestamp_seconds Time the last run finished.
+# TYPE sql_migrate_run_timestamp_seconds gauge
+sql_migrate_run_timestamp_seconds{environment="production",command="down",status="failure"} 1700000003
+`)
+}
+
+func (*MetricsSuite) TestWrite(c *C) {
+	run := newRunMetrics("up")
+	c.Assert(run.write(true), IsNil)
+
+	dir := c.MkDir()
+	MetricsFile = filepath.Join(dir, "sql_migrate.prom")
+	c.Assert(run.write(true), IsNil)
+
+	data, err := os.ReadFile(MetricsFile)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(data), `sql_migrate_run_migrations{environment="production",command="up",status="success"} 0`), Equals, true)
+
+	// Only the metrics file is left behind.
+	entries, err := os.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+}
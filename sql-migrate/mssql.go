@@ -10,4 +10,10 @@ import (
 
 func init() {
 	dialects["mssql"] = gorp.SqlServerDialect{}
+
+	// sqlserver is accepted as an alias, but always opened through the
+	// legacy mssql driver name: it is the one that understands the "?"
+	// placeholders emitted by gorp's SqlServerDialect.
+	dialects["sqlserver"] = gorp.SqlServerDialect{}
+	dialectAliases["sqlserver"] = "mssql"
 }
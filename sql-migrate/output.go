@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/mitchellh/cli"
+)
+
+// Quiet suppresses all output but errors and warnings, for scripts.
+var Quiet bool
+
+func outputFlags(f *flag.FlagSet) {
+	f.BoolVar(&Quiet, "quiet", false, "Only print errors and warnings.")
+}
+
+// outputHelp is the help text of outputFlags.
+const outputHelp = `  -quiet                 Only print errors and warnings.
+`
+
+// Colors of the output. They are left out when stdout is not a terminal, or
+// when NO_COLOR is set.
+var (
+	colorApplied = color.New(color.FgHiGreen)
+	colorPending = color.New(color.FgHiYellow)
+)
+
+// newUi returns the Ui of the commands, which prints errors in red and
+// warnings in yellow, and honours -quiet.
+func newUi() cli.Ui {
+	colored := stderrColored()
+	return &quietUi{Ui: &stderrColorUi{
+		Ui:    &cli.BasicUi{Reader: os.Stdin, Writer: os.Stdout, ErrorWriter: os.Stderr},
+		error: stderrColor(color.FgHiRed, colored),
+		warn:  stderrColor(color.FgHiYellow, colored),
+	}}
+}
+
+// stderrColored reports whether errors and warnings are colored: stderr is
+// a terminal, on its own, as the output may be redirected to a file while
+// the errors are still read on the terminal, or the other way around.
+func stderrColored() bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+}
+
+func stderrColor(attr color.Attribute, colored bool) *color.Color {
+	c := color.New(attr)
+	if colored {
+		c.EnableColor()
+	} else {
+		c.DisableColor()
+	}
+	return c
+}
+
+// stderrColorUi colors the errors and warnings. cli.ColoredUi can't be
+// used, it colors them when stdout is a terminal.
+type stderrColorUi struct {
+	cli.Ui
+	error *color.Color
+	warn  *color.Color
+}
+
+func (u *stderrColorUi) Error(message string) {
+	u.Ui.Error(u.error.Sprint(message))
+}
+
+func (u *stderrColorUi) Warn(message string) {
+	u.Ui.Warn(u.warn.Sprint(message))
+}
+
+// quietUi drops the regular output with -quiet, errors and warnings go
+// through.
+type quietUi struct {
+	cli.Ui
+}
+
+func (u *quietUi) Output(message string) {
+	if !Quiet {
+		u.Ui.Output(message)
+	}
+}
+
+func (u *quietUi) Info(message string) {
+	if !Quiet {
+		u.Ui.Info(message)
+	}
+}
+
+// outputWriter is where tables are written, nowhere with -quiet.
+func outputWriter() io.Writer {
+	if Quiet {
+		return io.Discard
+	}
+	return os.Stdout
+}
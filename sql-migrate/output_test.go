@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type OutputSuite struct{}
+
+var _ = Suite(&OutputSuite{})
+
+func (*OutputSuite) TestQuiet(c *C) {
+	defer func() { Quiet = false }()
+	mock := cli.NewMockUi()
+	u := &quietUi{Ui: mock}
+
+	Quiet = true
+	u.Output("Applied 1 migration")
+	u.Info("info")
+	u.Warn("Could not find migration file: 1_initial.sql")
+	u.Error("Migration failed")
+	c.Assert(mock.OutputWriter.String(), Equals, "")
+	c.Assert(mock.ErrorWriter.String(), Equals, "Could not find migration file: 1_initial.sql\nMigration failed\n")
+
+	Quiet = false
+	u.Output("Applied 1 migration")
+	c.Assert(mock.OutputWriter.String(), Equals, "Applied 1 migration\n")
+}
+
+func (*OutputSuite) TestColors(c *C) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+
+	color.NoColor = true
+	c.Assert(colorApplied.Sprint("Applied 1 migration"), Equals, "Applied 1 migration")
+
+	color.NoColor = false
+	c.Assert(colorApplied.Sprint("Applied 1 migration"), Equals, "\x1b[92mApplied 1 migration\x1b[0m")
+	c.Assert(colorPending.Sprint("no"), Equals, "\x1b[93mno\x1b[0m")
+}
+
+func (*OutputSuite) TestStderrColors(c *C) {
+	defer func(old bool) { color.NoColor = old }(color.NoColor)
+	// stdout is not a terminal, which doesn't matter for stderr.
+	color.NoColor = true
+
+	mock := cli.NewMockUi()
+	u := &stderrColorUi{Ui: mock, error: stderrColor(color.FgHiRed, true), warn: stderrColor(color.FgHiYellow, true)}
+	u.Error("Migration failed")
+	u.Warn("Could not find migration file: 1_initial.sql")
+	c.Assert(mock.ErrorWriter.String(), Equals, "\x1b[91mMigration failed\x1b[0m\n\x1b[93mCould not find migration file: 1_initial.sql\x1b[0m\n")
+
+	color.NoColor = false
+	mock = cli.NewMockUi()
+	u = &stderrColorUi{Ui: mock, error: stderrColor(color.FgHiRed, false), warn: stderrColor(color.FgHiYellow, false)}
+	u.Error("Migration failed")
+	u.Output("Applied 1 migration")
+	c.Assert(mock.ErrorWriter.String(), Equals, "Migration failed\n")
+	c.Assert(mock.OutputWriter.String(), Equals, "Applied 1 migration\n")
+
+	defer setenv("NO_COLOR", "1")()
+	c.Assert(stderrColored(), Equals, false)
+}
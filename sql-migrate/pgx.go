@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/go-gorp/gorp/v3"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func init() {
+	// pgx is a Postgres dialect in every respect (data sources, TLS,
+	// migration table DDL), it only differs in the database/sql driver.
+	dialects["pgx"] = gorp.PostgresDialect{}
+	dialectAliases["pgx"] = "postgres"
+	sqlDrivers["pgx"] = "pgx"
+}
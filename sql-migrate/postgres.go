@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// isPostgresTlsEnabled reports whether a CA certificate was configured for
+// Postgres through the environment, as understood by lib/pq.
+func isPostgresTlsEnabled() bool {
+	return os.Getenv("PGSSLROOTCERT") != ""
+}
+
+// PostgresTlsDataSource validates the certificates referenced by the
+// PGSSLROOTCERT, PGSSLCERT and PGSSLKEY environment variables and makes
+// sure the server certificate is verified against them.
+//
+// lib/pq reads those variables by itself, but with the default sslmode it
+// only checks the CA and not the host name. Unless an sslmode was set
+// explicitly, verify-full is requested.
+func PostgresTlsDataSource(dataSource string) (string, error) {
+	pem, err := os.ReadFile(os.Getenv("PGSSLROOTCERT"))
+	if err != nil {
+		return "", err
+	}
+
+	if ok := x509.NewCertPool().AppendCertsFromPEM(pem); !ok {
+		return "", fmt.Errorf("cannot append certs from PEM")
+	}
+
+	certFile, keyFile := os.Getenv("PGSSLCERT"), os.Getenv("PGSSLKEY")
+	if certFile != "" || keyFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return "", fmt.Errorf("cannot load client certificate: %w", err)
+		}
+	}
+
+	return postgresVerifyFullDataSource(dataSource)
+}
+
+// postgresVerifyFullDataSource requests verify-full, unless an sslmode was
+// set explicitly.
+func postgresVerifyFullDataSource(dataSource string) (string, error) {
+	if os.Getenv("PGSSLMODE") != "" || hasPostgresParam(dataSource, "sslmode") {
+		return dataSource, nil
+	}
+
+	return addPostgresParam(dataSource, "sslmode", "verify-full")
+}
+
+// postgresSslModes lists the sslmode values understood by each Postgres
+// driver, lib/pq does not implement allow and prefer.
+var postgresSslModes = map[string][]string{
+	"postgres": {"disable", "require", "verify-ca", "verify-full"},
+	"pgx":      {"disable", "allow", "prefer", "require", "verify-ca", "verify-full"},
+}
+
+// postgresSslMode returns the sslmode a connection is made with, from the
+// data source or PGSSLMODE. An empty string means the driver default.
+func postgresSslMode(dataSource string) string {
+	if mode, ok := postgresParam(dataSource, "sslmode"); ok {
+		return mode
+	}
+	return os.Getenv("PGSSLMODE")
+}
+
+// CheckPostgresSslMode makes sure the sslmode of the data source is
+// supported by the driver, before trying to connect with it.
+func CheckPostgresSslMode(driver, dataSource string) error {
+	mode := postgresSslMode(dataSource)
+	modes, ok := postgresSslModes[driver]
+	if mode == "" || !ok {
+		return nil
+	}
+
+	for _, m := range modes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported sslmode %q, use one of %s", mode, strings.Join(modes, ", "))
+}
+
+// PostgresTlsHint adds a hint on how to fix the most common TLS failures to
+// an error returned when connecting to Postgres. Other errors are returned
+// as is.
+func PostgresTlsHint(err error, dataSource string) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var hint string
+
+	switch {
+	case errors.As(err, &unknownAuthority) || strings.Contains(err.Error(), "certificate signed by unknown authority"):
+		if _, ok := postgresParam(dataSource, "sslrootcert"); ok || os.Getenv("PGSSLROOTCERT") != "" {
+			hint = "the server certificate is not signed by the CA in sslrootcert, check that it points to the CA of the server"
+		} else {
+			hint = "the server certificate is not signed by a trusted CA, set sslrootcert (or PGSSLROOTCERT) to the CA certificate of the server"
+		}
+	case errors.As(err, &hostname) || strings.Contains(err.Error(), "x509: certificate is valid for"):
+		hint = "the server certificate does not match the host, connect with a host name from the certificate or use sslmode=verify-ca"
+	case strings.Contains(err.Error(), "SSL is not enabled on the server") || strings.Contains(err.Error(), "server refused TLS connection"):
+		hint = "the server does not accept TLS connections, enable ssl on the server or use sslmode=disable"
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w (hint: %s)", err, hint)
+}
+
+// isPostgresSocket reports whether a connection made with the data source
+// goes over a Unix socket, that is whether its host, or PGHOST when it has
+// none, is a directory.
+func isPostgresSocket(dataSource string) bool {
+	host, ok := postgresParam(dataSource, "host")
+	if !ok && isPostgresURL(dataSource) {
+		if u, err := url.Parse(dataSource); err == nil && u.Host != "" {
+			return false
+		}
+	}
+	if !ok {
+		host = os.Getenv("PGHOST")
+	}
+	return strings.HasPrefix(host, "/")
+}
+
+// PostgresSocketDataSource disables TLS for connections over a Unix socket,
+// unless an sslmode was set explicitly. lib/pq would otherwise request TLS,
+// which servers reject on sockets.
+func PostgresSocketDataSource(dataSource string) (string, error) {
+	if postgresSslMode(dataSource) != "" {
+		return dataSource, nil
+	}
+	return addPostgresParam(dataSource, "sslmode", "disable")
+}
+
+var postgresIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// PostgresSearchPathDataSource makes every connection opened with the data
+// source use the given search_path, a comma-separated list of schemas.
+//
+// The search_path is sent as a startup parameter rather than through SET
+// search_path, which would only apply to one of the connections of the
+// pool. The schemas are validated, as they end up in the session settings.
+func PostgresSearchPathDataSource(dataSource, searchPath string) (string, error) {
+	if hasPostgresParam(dataSource, "search_path") {
+		return "", fmt.Errorf("search_path is set both in the data source and as searchpath")
+	}
+
+	schemas := strings.Split(searchPath, ",")
+	for i, schema := range schemas {
+		schema = strings.TrimSpace(schema)
+		switch {
+		case schema == "$user" || schema == `"$user"`:
+			schema = `"$user"`
+		case !postgresIdentifierRegex.MatchString(schema):
+			return "", fmt.Errorf("invalid schema %q in searchpath", schema)
+		}
+		schemas[i] = schema
+	}
+
+	return addPostgresParam(dataSource, "search_path", strings.Join(schemas, ", "))
+}
+
+// CreatePostgresSchema creates the schema unless it exists, and reports
+// whether it did. The existence is checked first, as CREATE SCHEMA IF NOT
+// EXISTS still requires the CREATE privilege on the database.
+func CreatePostgresSchema(ctx context.Context, db *sql.DB, schema string) (bool, error) {
+	if !postgresIdentifierRegex.MatchString(schema) {
+		return false, fmt.Errorf("invalid schema %q", schema)
+	}
+
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_namespace WHERE nspname = $1)", schema).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("cannot check schema %s: %w", schema, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schema)); err != nil {
+		return false, fmt.Errorf("cannot create schema %s: %w", schema, err)
+	}
+	return true, nil
+}
+
+func isPostgresURL(dataSource string) bool {
+	return strings.HasPrefix(dataSource, "postgres://") || strings.HasPrefix(dataSource, "postgresql://")
+}
+
+// hasPostgresParam reports whether the key is set in either a URL or a
+// key/value style data source.
+func hasPostgresParam(dataSource, key string) bool {
+	if isPostgresURL(dataSource) {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return false
+		}
+		return u.Query().Has(key)
+	}
+
+	re := regexp.MustCompile(`(^|\s)` + regexp.QuoteMeta(key) + `\s*=`)
+	return re.MatchString(dataSource)
+}
+
+var postgresParamRegex = regexp.MustCompile(`(?:^|\s)([A-Za-z_]+)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// postgresParam returns the value of a parameter of a URL or key/value style
+// data source.
+func postgresParam(dataSource, key string) (string, bool) {
+	if isPostgresURL(dataSource) {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return "", false
+		}
+		q := u.Query()
+		return q.Get(key), q.Has(key)
+	}
+
+	unescaper := strings.NewReplacer(`\\`, `\`, `\'`, `'`)
+	for _, m := range postgresParamRegex.FindAllStringSubmatch(dataSource, -1) {
+		if m[1] != key {
+			continue
+		}
+		value := m[2]
+		if strings.HasPrefix(value, "'") {
+			value = unescaper.Replace(value[1 : len(value)-1])
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// addPostgresParam appends a parameter to a URL or key/value style data
+// source.
+func addPostgresParam(dataSource, key, value string) (string, error) {
+	if isPostgresURL(dataSource) {
+		u, err := url.Parse(dataSource)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	param := fmt.Sprintf("%s='%s'", key, escaper.Replace(value))
+	if strings.TrimSpace(dataSource) == "" {
+		return param, nil
+	}
+	return dataSource + " " + param, nil
+}
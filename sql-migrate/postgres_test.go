@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type PostgresSuite struct{}
+
+var _ = Suite(&PostgresSuite{})
+
+func (*PostgresSuite) TestHasPostgresParam(c *C) {
+	c.Assert(hasPostgresParam("dbname=test sslmode=disable", "sslmode"), Equals, true)
+	c.Assert(hasPostgresParam("sslmode = disable", "sslmode"), Equals, true)
+	c.Assert(hasPostgresParam("dbname=test", "sslmode"), Equals, false)
+	c.Assert(hasPostgresParam("password=mysslmode=x", "sslmode"), Equals, false)
+	c.Assert(hasPostgresParam("postgres://u@localhost/test?sslmode=disable", "sslmode"), Equals, true)
+	c.Assert(hasPostgresParam("postgres://u@localhost/test", "sslmode"), Equals, false)
+}
+
+func (*PostgresSuite) TestAddPostgresParam(c *C) {
+	ds, err := addPostgresParam("dbname=test", "sslmode", "verify-full")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "dbname=test sslmode='verify-full'")
+
+	ds, err = addPostgresParam("", "application_name", `it's`)
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, `application_name='it\'s'`)
+
+	ds, err = addPostgresParam("postgres://u@localhost/test?connect_timeout=5", "sslmode", "verify-full")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "postgres://u@localhost/test?connect_timeout=5&sslmode=verify-full")
+}
+
+func (*PostgresSuite) TestPostgresParam(c *C) {
+	value, ok := postgresParam("dbname=test sslmode=verify-ca", "sslmode")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "verify-ca")
+
+	value, ok = postgresParam(`application_name='it\'s a test' sslmode = 'require'`, "sslmode")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "require")
+
+	value, ok = postgresParam(`application_name='sslmode=disable'`, "sslmode")
+	c.Assert(ok, Equals, false)
+	c.Assert(value, Equals, "")
+
+	value, ok = postgresParam("postgres://u@localhost/test?sslmode=disable", "sslmode")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "disable")
+}
+
+func (*PostgresSuite) TestCheckPostgresSslMode(c *C) {
+	defer setenv("PGSSLMODE", "")()
+
+	c.Assert(CheckPostgresSslMode("postgres", "dbname=test"), IsNil)
+	c.Assert(CheckPostgresSslMode("postgres", "dbname=test sslmode=verify-full"), IsNil)
+	c.Assert(CheckPostgresSslMode("pgx", "postgres://u@localhost/test?sslmode=prefer"), IsNil)
+
+	err := CheckPostgresSslMode("postgres", "dbname=test sslmode=prefer")
+	c.Assert(err, ErrorMatches, `unsupported sslmode "prefer", use one of disable, require, verify-ca, verify-full`)
+
+	os.Setenv("PGSSLMODE", "verify")
+	err = CheckPostgresSslMode("pgx", "dbname=test")
+	c.Assert(err, ErrorMatches, `unsupported sslmode "verify", use one of disable, allow, prefer, require, verify-ca, verify-full`)
+}
+
+func (*PostgresSuite) TestPostgresTlsHint(c *C) {
+	dir := c.MkDir()
+	serverCA := newTestCA(c, dir)
+
+	addr := servePostgresTls(c, serverCA.Issue(c, x509.ExtKeyUsageServerAuth))
+	ds := fmt.Sprintf("host=localhost port=%d dbname=test user=test sslmode=verify-full", addr.Port)
+
+	_, _, err := GetConnection(&Environment{Dialect: "postgres", DataSource: ds})
+	c.Assert(err, ErrorMatches, `.*certificate signed by unknown authority \(hint: the server certificate is not signed by a trusted CA, set sslrootcert .*`)
+
+	ds = fmt.Sprintf("host=localhost port=%d dbname=test user=test sslmode=verify-full sslrootcert=%s", addr.Port, serverCA.File)
+	_, _, err = GetConnection(&Environment{Dialect: "postgres", DataSource: ds})
+	c.Assert(err, Not(ErrorMatches), ".*hint.*")
+
+	err = PostgresTlsHint(x509.HostnameError{Certificate: &x509.Certificate{DNSNames: []string{"localhost"}}, Host: "db.example.com"}, ds)
+	c.Assert(err, ErrorMatches, `x509: certificate is valid for localhost, not db.example.com \(hint: the server certificate does not match the host, .*`)
+
+	err = PostgresTlsHint(errors.New("pq: SSL is not enabled on the server"), "dbname=test")
+	c.Assert(err, ErrorMatches, `pq: SSL is not enabled on the server \(hint: the server does not accept TLS connections, .*`)
+
+	err = PostgresTlsHint(errors.New("pq: password authentication failed"), ds)
+	c.Assert(err, ErrorMatches, "pq: password authentication failed")
+}
+
+func (*PostgresSuite) TestIsPostgresSocket(c *C) {
+	defer setenv("PGHOST", "")()
+
+	c.Assert(isPostgresSocket("host=/var/run/postgresql dbname=test"), Equals, true)
+	c.Assert(isPostgresSocket("postgres://u@/test?host=%2Fvar%2Frun%2Fpostgresql"), Equals, true)
+	c.Assert(isPostgresSocket("host=localhost dbname=test"), Equals, false)
+	c.Assert(isPostgresSocket("postgres://u@localhost/test"), Equals, false)
+	c.Assert(isPostgresSocket("dbname=test"), Equals, false)
+
+	os.Setenv("PGHOST", "/tmp")
+	c.Assert(isPostgresSocket("dbname=test"), Equals, true)
+	c.Assert(isPostgresSocket("postgres://u@localhost/test"), Equals, false)
+}
+
+func (*PostgresSuite) TestPostgresSocketDataSource(c *C) {
+	defer setenv("PGSSLMODE", "")()
+
+	ds, err := PostgresSocketDataSource("host=/tmp dbname=test")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "host=/tmp dbname=test sslmode='disable'")
+
+	ds, err = PostgresSocketDataSource("host=/tmp dbname=test sslmode=require")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "host=/tmp dbname=test sslmode=require")
+}
+
+func (*PostgresSuite) TestPostgresSocketPing(c *C) {
+	dir := c.MkDir()
+	servePostgresSocket(c, filepath.Join(dir, ".s.PGSQL.5432"))
+
+	// PGSSLROOTCERT would require TLS over TCP, it has no effect on sockets.
+	ca := newTestCA(c, c.MkDir())
+	defer setenv("PGSSLROOTCERT", ca.File)()
+	defer setenv("PGSSLMODE", "")()
+
+	db, _, err := GetConnection(&Environment{Dialect: "postgres", DataSource: fmt.Sprintf("host=%s dbname=test user=test", dir)})
+	c.Assert(err, IsNil)
+	c.Assert(db.Close(), IsNil)
+}
+
+func (*PostgresSuite) TestRequireWritable(c *C) {
+	dir := c.MkDir()
+	servePostgresSocketResults(c, filepath.Join(dir, ".s.PGSQL.5432"), map[string]string{"SHOW transaction_read_only": "on"})
+
+	env := &Environment{Dialect: "postgres", DataSource: fmt.Sprintf("host=%s dbname=test user=test", dir), RequireWritable: true}
+	_, _, err := GetConnection(env)
+	c.Assert(err, ErrorMatches, `The database is read-only \(transaction_read_only is on\), point the data source at the primary`)
+
+	primary := c.MkDir()
+	servePostgresSocketResults(c, filepath.Join(primary, ".s.PGSQL.5432"), map[string]string{"SHOW transaction_read_only": "off"})
+	env.DataSource = fmt.Sprintf("host=%s dbname=test user=test", primary)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	c.Assert(db.Close(), IsNil)
+}
+
+func (*PostgresSuite) TestPostgresSearchPath(c *C) {
+	ds, err := PostgresSearchPathDataSource("dbname=test", "tenant")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "dbname=test search_path='tenant'")
+
+	ds, err = PostgresSearchPathDataSource("postgres://u@localhost/test", "tenant_1, $user,public")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "postgres://u@localhost/test?search_path=tenant_1%2C+%22%24user%22%2C+public")
+
+	_, err = PostgresSearchPathDataSource("dbname=test", "public; DROP TABLE users")
+	c.Assert(err, ErrorMatches, `invalid schema "public; DROP TABLE users" in searchpath`)
+
+	_, err = PostgresSearchPathDataSource("dbname=test", "tenant,")
+	c.Assert(err, ErrorMatches, `invalid schema "" in searchpath`)
+
+	_, err = PostgresSearchPathDataSource("dbname=test search_path=public", "tenant")
+	c.Assert(err, ErrorMatches, "search_path is set both in the data source and as searchpath")
+}
+
+func (*PostgresSuite) TestCreatePostgresSchemaInvalid(c *C) {
+	// Rejected before the database is used.
+	_, err := CreatePostgresSchema(context.Background(), nil, `tenant"; DROP TABLE people; --`)
+	c.Assert(err, ErrorMatches, `invalid schema "tenant\\"; DROP TABLE people; --"`)
+}
+
+func (*PostgresSuite) TestPostgresTlsKeepsExplicitMode(c *C) {
+	ca := newTestCA(c, c.MkDir())
+	defer setenv("PGSSLROOTCERT", ca.File)()
+
+	ds, err := PostgresTlsDataSource("dbname=test sslmode=verify-ca")
+	c.Assert(err, IsNil)
+	c.Assert(ds, Equals, "dbname=test sslmode=verify-ca")
+}
+
+func (*PostgresSuite) TestPostgresTlsInvalidCA(c *C) {
+	dir := c.MkDir()
+	file := dir + "/ca.pem"
+	writePEM(c, file, "GARBAGE", nil)
+	defer setenv("PGSSLROOTCERT", file)()
+
+	_, err := PostgresTlsDataSource("dbname=test")
+	c.Assert(err, ErrorMatches, "cannot append certs from PEM")
+}
+
+func (*PostgresSuite) TestPostgresTlsVerifiesServer(c *C) {
+	dir := c.MkDir()
+	serverCA := newTestCA(c, dir)
+	otherCA := newTestCA(c, dir)
+
+	addr := servePostgresTls(c, serverCA.Issue(c, x509.ExtKeyUsageServerAuth))
+	ds := fmt.Sprintf("host=localhost port=%d dbname=test user=test", addr.Port)
+
+	restore := setenv("PGSSLROOTCERT", otherCA.File)
+	_, _, err := GetConnection(&Environment{Dialect: "postgres", DataSource: ds})
+	restore()
+	c.Assert(err, ErrorMatches, ".*certificate signed by unknown authority.*")
+
+	// With the right CA, the handshake succeeds and the connection only
+	// fails because the fake server hangs up after TLS.
+	restore = setenv("PGSSLROOTCERT", serverCA.File)
+	_, _, err = GetConnection(&Environment{Dialect: "postgres", DataSource: ds})
+	restore()
+	c.Assert(err, NotNil)
+	c.Assert(err, Not(ErrorMatches), ".*(x509|certificate).*")
+}
+
+// servePostgresTls accepts connections, answers the SSLRequest and performs
+// a TLS handshake with the given certificate before hanging up.
+func servePostgresTls(c *C, cert tls.Certificate) *net.TCPAddr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 8)
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				if _, err := conn.Write([]byte("S")); err != nil {
+					return
+				}
+				_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+			}()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr)
+}
+
+// servePostgresSocket listens on a Unix socket and speaks just enough of the
+// Postgres protocol to accept a connection without TLS and answer pings.
+func servePostgresSocket(c *C, path string) {
+	servePostgresSocketResults(c, path, nil)
+}
+
+// servePostgresSocketResults answers the queries listed in results with a
+// single text value, and any other query with an empty response.
+func servePostgresSocketResults(c *C, path string, results map[string]string) {
+	l, err := net.Listen("unix", path)
+	c.Assert(err, IsNil)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length uint32
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				startup := make([]byte, length-4)
+				if _, err := io.ReadFull(conn, startup); err != nil {
+					return
+				}
+				if binary.BigEndian.Uint32(startup) != 196608 {
+					// Not a protocol 3.0 startup, such as an SSLRequest.
+					return
+				}
+
+				// AuthenticationOk and ReadyForQuery.
+				_, _ = conn.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+				for {
+					header := make([]byte, 5)
+					if _, err := io.ReadFull(conn, header); err != nil || header[0] != 'Q' {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					if value, ok := results[strings.TrimRight(string(query), "\x00")]; ok {
+						_, _ = conn.Write(postgresTextResult(value))
+						continue
+					}
+					// EmptyQueryResponse and ReadyForQuery.
+					_, _ = conn.Write([]byte{'I', 0, 0, 0, 4, 'Z', 0, 0, 0, 5, 'I'})
+				}
+			}()
+		}
+	}()
+}
+
+// postgresTextResult encodes a result with a single text column and row,
+// followed by ReadyForQuery.
+func postgresTextResult(value string) []byte {
+	message := func(kind byte, body []byte) []byte {
+		out := []byte{kind, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(out[1:], uint32(len(body)+4))
+		return append(out, body...)
+	}
+
+	var field []byte
+	field = append(field, 0, 1, 'v', 0)
+	field = binary.BigEndian.AppendUint32(field, 0)
+	field = binary.BigEndian.AppendUint16(field, 0)
+	field = binary.BigEndian.AppendUint32(field, 25)
+	field = binary.BigEndian.AppendUint16(field, 0xffff)
+	field = binary.BigEndian.AppendUint32(field, 0xffffffff)
+	field = binary.BigEndian.AppendUint16(field, 0)
+
+	var row []byte
+	row = binary.BigEndian.AppendUint16(row, 1)
+	row = binary.BigEndian.AppendUint32(row, uint32(len(value)))
+	row = append(row, value...)
+
+	var out []byte
+	out = append(out, message('T', field)...)
+	out = append(out, message('D', row)...)
+	out = append(out, message('C', []byte("SELECT 1\x00"))...)
+	return append(out, 'Z', 0, 0, 0, 5, 'I')
+}
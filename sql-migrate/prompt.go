@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+var (
+	AssumeYes          bool
+	NonInteractive     bool
+	ConfirmEnvironment string
+)
+
+// isTerminal reports whether prompts can be answered, that is whether stdin
+// is a terminal.
+var isTerminal = func() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+func promptFlags(f *flag.FlagSet) {
+	f.BoolVar(&AssumeYes, "yes", false, "Answer yes to confirmation prompts.")
+	f.BoolVar(&NonInteractive, "non-interactive", false, "Fail instead of prompting for confirmation.")
+	f.StringVar(&ConfirmEnvironment, "confirm", "", "Name of the environment, to confirm operations on a production environment.")
+}
+
+// promptHelp is the help text of promptFlags.
+const promptHelp = `  -yes                   Answer yes to confirmation prompts.
+  -non-interactive       Fail instead of prompting for confirmation.
+  -confirm=env           Name of the environment, required when it is marked as
+                         production.
+`
+
+// Confirm asks the user to confirm the question. With -yes it is confirmed
+// without asking. With -non-interactive, or when stdin is not a terminal, it
+// fails instead of blocking on a prompt nobody can answer.
+func Confirm(question string) error {
+	if AssumeYes {
+		logger().Info("confirmed with -yes", "question", question)
+		return nil
+	}
+
+	if NonInteractive || !isTerminal() {
+		return fmt.Errorf("%s Confirmation needed, pass -yes to confirm", question)
+	}
+
+	answer, err := ui.Ask(question + " [y/N]")
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return errors.New("Aborted")
+	}
+}
+
+// confirmProduction guards operations on an environment marked as
+// production: they need -confirm with the name of the environment, which is
+// asked for when missing and stdin is a terminal. Unlike other prompts, -yes
+// does not confirm them.
+func confirmProduction(env *Environment, action string) error {
+	if !env.Production {
+		return nil
+	}
+
+	switch ConfirmEnvironment {
+	case ConfigEnvironment:
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("-confirm %s does not match the environment %s", ConfirmEnvironment, ConfigEnvironment)
+	}
+
+	question := fmt.Sprintf("%s in production environment %s?", action, ConfigEnvironment)
+	if NonInteractive || !isTerminal() {
+		return fmt.Errorf("%s Pass -confirm %s to confirm", question, ConfigEnvironment)
+	}
+
+	answer, err := ui.Ask(question + " Type its name to confirm:")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(answer) != ConfigEnvironment {
+		return errors.New("Aborted")
+	}
+	return nil
+}
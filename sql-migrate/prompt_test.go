@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type PromptSuite struct {
+	ui         cli.Ui
+	isTerminal func() bool
+}
+
+var _ = Suite(&PromptSuite{})
+
+func (s *PromptSuite) SetUpTest(*C) {
+	s.ui = ui
+	s.isTerminal = isTerminal
+	isTerminal = func() bool { return true }
+}
+
+func (s *PromptSuite) TearDownTest(*C) {
+	ui = s.ui
+	isTerminal = s.isTerminal
+	AssumeYes = false
+	NonInteractive = false
+	ConfirmEnvironment = ""
+}
+
+func (*PromptSuite) answer(input string) *cli.MockUi {
+	mock := cli.NewMockUi()
+	mock.InputReader = strings.NewReader(input)
+	ui = mock
+	return mock
+}
+
+func (s *PromptSuite) TestConfirm(c *C) {
+	mock := s.answer("yes\n")
+	c.Assert(Confirm("Proceed?"), IsNil)
+	c.Assert(mock.OutputWriter.String(), Equals, "Proceed? [y/N]")
+
+	s.answer("\n")
+	c.Assert(Confirm("Proceed?"), ErrorMatches, "Aborted")
+}
+
+func (s *PromptSuite) TestConfirmAssumeYes(c *C) {
+	mock := s.answer("")
+	AssumeYes = true
+	NonInteractive = true
+	c.Assert(Confirm("Proceed?"), IsNil)
+	c.Assert(mock.OutputWriter.String(), Equals, "")
+}
+
+func (s *PromptSuite) TestConfirmNonInteractive(c *C) {
+	s.answer("y\n")
+	NonInteractive = true
+	c.Assert(Confirm("Proceed?"), ErrorMatches, `Proceed\? Confirmation needed, pass -yes to confirm`)
+
+	NonInteractive = false
+	isTerminal = func() bool { return false }
+	c.Assert(Confirm("Proceed?"), ErrorMatches, `Proceed\? Confirmation needed, pass -yes to confirm`)
+}
+
+func (s *PromptSuite) TestConfirmProduction(c *C) {
+	defer func(name string) { ConfigEnvironment = name }(ConfigEnvironment)
+	ConfigEnvironment = "production"
+	prod := &Environment{Production: true}
+
+	s.answer("")
+	c.Assert(confirmProduction(&Environment{}, "Roll back migrations"), IsNil)
+
+	NonInteractive = true
+	AssumeYes = true
+	c.Assert(confirmProduction(prod, "Roll back migrations"), ErrorMatches, `Roll back migrations in production environment production\? Pass -confirm production to confirm`)
+
+	ConfirmEnvironment = "staging"
+	c.Assert(confirmProduction(prod, "Roll back migrations"), ErrorMatches, "-confirm staging does not match the environment production")
+
+	ConfirmEnvironment = "production"
+	c.Assert(confirmProduction(prod, "Roll back migrations"), IsNil)
+}
+
+func (s *PromptSuite) TestConfirmProductionPrompt(c *C) {
+	defer func(name string) { ConfigEnvironment = name }(ConfigEnvironment)
+	ConfigEnvironment = "production"
+	prod := &Environment{Production: true}
+
+	mock := s.answer("production\n")
+	c.Assert(confirmProduction(prod, "Roll back migrations"), IsNil)
+	c.Assert(mock.OutputWriter.String(), Equals, "Roll back migrations in production environment production? Type its name to confirm:")
+
+	s.answer("y\n")
+	c.Assert(confirmProduction(prod, "Roll back migrations"), ErrorMatches, "Aborted")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// configClient fetches the configuration files given as URLs.
+var configClient = http.DefaultClient
+
+// configFetchTimeout bounds the time spent fetching a configuration file.
+var configFetchTimeout = 30 * time.Second
+
+// maxConfigSize is the size above which a fetched configuration is refused.
+const maxConfigSize = 10 << 20
+
+// remoteConfigs caches the fetched configuration files, so that a command
+// reading the config several times sees the same one.
+var remoteConfigs = map[string][]byte{}
+
+// isConfigURL reports whether a configuration file is given as an http or
+// https URL.
+func isConfigURL(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// configURLLabel is how a configuration URL appears in messages: without
+// its credentials or query, which may hold tokens. Its path still tells the
+// format of the file.
+func configURLLabel(name string) string {
+	u, err := url.Parse(name)
+	if err != nil {
+		return MaskDataSource(name)
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// fetchConfig downloads a configuration file, sending SQL_MIGRATE_CONFIG_TOKEN
+// as a bearer token when set.
+func fetchConfig(name string) ([]byte, error) {
+	if file, ok := remoteConfigs[name]; ok {
+		return file, nil
+	}
+	label := configURLLabel(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), configFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL %s: %w", label, err)
+	}
+	if token := os.Getenv("SQL_MIGRATE_CONFIG_TOKEN"); token != "" {
+		if req.URL.Scheme == "http" {
+			ui.Warn(fmt.Sprintf("Sending SQL_MIGRATE_CONFIG_TOKEN to %s without TLS", label))
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := configClient.Do(req)
+	if err != nil {
+		// The error repeats the URL, query included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("cannot fetch the config from %s: %w", label, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch the config from %s (%s)", label, resp.Status)
+	}
+	file, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the config from %s: %w", label, err)
+	}
+	if len(file) > maxConfigSize {
+		return nil, fmt.Errorf("the config at %s is larger than %d bytes", label, maxConfigSize)
+	}
+
+	logger().Info("config fetched", "url", label, "duration", time.Since(start))
+	remoteConfigs[name] = file
+	return file, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteObject is a migration file of a remote dir.
+type remoteObject struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// remoteStore lists and downloads the migration files of a remote dir.
+type remoteStore interface {
+	// List returns the .sql files directly under prefix in bucket.
+	List(ctx context.Context, bucket, prefix string) ([]remoteObject, error)
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// remoteStores holds the stores compiled in, keyed by URL scheme. Like the
+// secret resolvers, the ones with heavy dependencies register themselves
+// from files guarded by a build tag.
+var remoteStores = map[string]func(ctx context.Context) (remoteStore, error){}
+
+// remoteDirSchemes maps the supported remote dir schemes to the build tag
+// that enables them.
+var remoteDirSchemes = map[string]string{
+	"s3": "aws",
+}
+
+// userCacheDir returns the directory the remote dirs are downloaded to.
+var userCacheDir = os.UserCacheDir
+
+// remoteDirScheme returns the scheme of a remote dir, such as
+// s3://bucket/prefix, or an empty string for local directories.
+func remoteDirScheme(dir string) string {
+	scheme, _, ok := strings.Cut(dir, "://")
+	if !ok {
+		return ""
+	}
+	if _, known := remoteDirSchemes[scheme]; !known {
+		return ""
+	}
+	return scheme
+}
+
+// fetchRemoteDir downloads the migration files of a remote dir to the
+// cache, and returns the cache directory to read them from. Files are only
+// downloaded again when their size or modification time changed, and the
+// files removed from the remote dir are removed from the cache.
+func fetchRemoteDir(ctx context.Context, dir string) (string, error) {
+	scheme := remoteDirScheme(dir)
+	newStore, ok := remoteStores[scheme]
+	if !ok {
+		return "", fmt.Errorf("%s dirs are not supported by this build, rebuild with -tags %s", scheme, remoteDirSchemes[scheme])
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dir, scheme+"://"), "/")
+	if bucket == "" {
+		return "", fmt.Errorf("%s has no bucket", dir)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	cache, err := userCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot cache %s: %w", dir, err)
+	}
+	local := filepath.Join(cache, "sql-migrate", scheme, bucket, filepath.FromSlash(prefix))
+	if err := os.MkdirAll(local, 0o755); err != nil {
+		return "", fmt.Errorf("cannot cache %s: %w", dir, err)
+	}
+
+	store, err := newStore(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", dir, err)
+	}
+	objects, err := store.List(ctx, bucket, prefix)
+	if err != nil {
+		return "", fmt.Errorf("cannot list %s: %w", dir, err)
+	}
+	if len(objects) == 0 {
+		return "", fmt.Errorf("no migrations found in %s", dir)
+	}
+
+	keep := make(map[string]bool, len(objects))
+	downloaded := 0
+	for _, object := range objects {
+		keep[object.Name] = true
+		file := filepath.Join(local, object.Name)
+		if info, err := os.Stat(file); err == nil && info.Size() == object.Size && info.ModTime().Equal(object.Modified) {
+			continue
+		}
+		if err := downloadRemoteObject(ctx, store, bucket, prefix+object.Name, file, object.Modified); err != nil {
+			return "", fmt.Errorf("cannot download %s%s: %w", strings.TrimSuffix(dir, "/")+"/", object.Name, err)
+		}
+		downloaded++
+	}
+
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && !keep[entry.Name()] {
+			if err := os.Remove(filepath.Join(local, entry.Name())); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	logger().Info("remote dir fetched", "dir", dir, "cache", local, "files", len(objects), "downloaded", downloaded)
+	return local, nil
+}
+
+// downloadRemoteObject writes an object to file, through a temporary file
+// so that an interrupted download isn't mistaken for a cached one.
+func downloadRemoteObject(ctx context.Context, store remoteStore, bucket, key, file string, modified time.Time) error {
+	body, err := store.Get(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), modified, modified); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// validateRemoteDir checks that a remote dir is the only dir of the
+// environment, read as files.
+func validateRemoteDir(env *Environment) error {
+	for _, dir := range append([]string{env.Dir}, env.Dirs...) {
+		scheme := remoteDirScheme(dir)
+		if scheme == "" {
+			continue
+		}
+		if len(env.Dirs) > 1 {
+			return fmt.Errorf("%s dirs cannot be listed with other dirs", scheme)
+		}
+		if isDirPattern(dir) {
+			return fmt.Errorf("%s dirs cannot be glob patterns", scheme)
+		}
+		if env.Source == "embed" {
+			return fmt.Errorf("%s dirs need source file", scheme)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type RemoteDirSuite struct {
+	stores       map[string]func(ctx context.Context) (remoteStore, error)
+	userCacheDir func() (string, error)
+	cache        string
+}
+
+var _ = Suite(&RemoteDirSuite{})
+
+func (s *RemoteDirSuite) SetUpTest(c *C) {
+	s.stores = remoteStores
+	remoteStores = map[string]func(ctx context.Context) (remoteStore, error){}
+	s.userCacheDir = userCacheDir
+	s.cache = c.MkDir()
+	userCacheDir = func() (string, error) { return s.cache, nil }
+}
+
+func (s *RemoteDirSuite) TearDownTest(*C) {
+	remoteStores = s.stores
+	userCacheDir = s.userCacheDir
+}
+
+// fakeStore holds the files of a single bucket, keyed by object key.
+type fakeStore struct {
+	bucket   string
+	files    map[string]string
+	modified time.Time
+	gets     int
+	err      error
+}
+
+func (f *fakeStore) List(_ context.Context, bucket, prefix string) ([]remoteObject, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if bucket != f.bucket {
+		return nil, errors.New("bucket " + bucket + " does not exist")
+	}
+	var objects []remoteObject
+	for key, content := range f.files {
+		if name, ok := strings.CutPrefix(key, prefix); ok && !strings.Contains(name, "/") {
+			objects = append(objects, remoteObject{Name: name, Size: int64(len(content)), Modified: f.modified})
+		}
+	}
+	return objects, nil
+}
+
+func (f *fakeStore) Get(_ context.Context, _, key string) (io.ReadCloser, error) {
+	f.gets++
+	return io.NopCloser(strings.NewReader(f.files[key])), nil
+}
+
+func (f *fakeStore) register() {
+	remoteStores["s3"] = func(context.Context) (remoteStore, error) { return f, nil }
+}
+
+func (*RemoteDirSuite) TestRemoteDirScheme(c *C) {
+	c.Assert(remoteDirScheme("s3://bucket/migrations"), Equals, "s3")
+	c.Assert(remoteDirScheme("migrations"), Equals, "")
+	c.Assert(remoteDirScheme("gs://bucket/migrations"), Equals, "")
+}
+
+func (s *RemoteDirSuite) TestFetchRemoteDir(c *C) {
+	store := &fakeStore{
+		bucket: "bundles",
+		files: map[string]string{
+			"v1/1_initial.sql":  "-- +migrate Up\nCREATE TABLE people (id int);\n",
+			"v1/2_record.sql":   "-- +migrate Up\nINSERT INTO people (id) VALUES (1);\n",
+			"v1/old/3_skip.sql": "-- +migrate Up\n",
+		},
+		modified: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	store.register()
+
+	dir, err := fetchRemoteDir(context.Background(), "s3://bundles/v1/")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, filepath.Join(s.cache, "sql-migrate", "s3", "bundles", "v1"))
+	c.Assert(store.gets, Equals, 2)
+	content, err := os.ReadFile(filepath.Join(dir, "1_initial.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, store.files["v1/1_initial.sql"])
+
+	migrations, err := migrationSource(&Environment{Dir: dir}).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 2)
+
+	// Unchanged files are cached, removed ones are dropped from the cache.
+	delete(store.files, "v1/2_record.sql")
+	store.files["v1/3_index.sql"] = "-- +migrate Up\nCREATE INDEX people_id ON people (id);\n"
+	_, err = fetchRemoteDir(context.Background(), "s3://bundles/v1")
+	c.Assert(err, IsNil)
+	c.Assert(store.gets, Equals, 3)
+	_, err = os.Stat(filepath.Join(dir, "2_record.sql"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (*RemoteDirSuite) TestFetchRemoteDirErrors(c *C) {
+	_, err := fetchRemoteDir(context.Background(), "s3://bundles/v1")
+	c.Assert(err, ErrorMatches, "s3 dirs are not supported by this build, rebuild with -tags aws")
+
+	store := &fakeStore{bucket: "bundles", files: map[string]string{}}
+	store.register()
+	_, err = fetchRemoteDir(context.Background(), "s3://bundles/v1")
+	c.Assert(err, ErrorMatches, "no migrations found in s3://bundles/v1")
+	_, err = fetchRemoteDir(context.Background(), "s3://missing/v1")
+	c.Assert(err, ErrorMatches, "cannot list s3://missing/v1: bucket missing does not exist")
+
+	store.err = errors.New("access denied to bucket bundles")
+	_, err = fetchRemoteDir(context.Background(), "s3://bundles/v1")
+	c.Assert(err, ErrorMatches, "cannot list s3://bundles/v1: access denied to bucket bundles")
+}
+
+func (*RemoteDirSuite) TestValidateRemoteDir(c *C) {
+	c.Assert(validateRemoteDir(&Environment{Dir: "s3://bundles/v1"}), IsNil)
+	c.Assert(validateRemoteDir(&Environment{Dir: "s3://bundles/v1", Dirs: []string{"s3://bundles/v1", "migrations"}}), ErrorMatches, "s3 dirs cannot be listed with other dirs")
+	c.Assert(validateRemoteDir(&Environment{Dir: "s3://bundles/v*"}), ErrorMatches, "s3 dirs cannot be glob patterns")
+	c.Assert(validateRemoteDir(&Environment{Dir: "s3://bundles/v1", Source: "embed"}), ErrorMatches, "s3 dirs need source file")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// retryBackoff is the delay before retrying a migration that failed on a
+// transient error, it doubles with every attempt.
+var retryBackoff = time.Second
+
+// transientCodes are the errors a migration is retried on: serialization
+// failures and deadlocks, by SQLSTATE for Postgres and error number for
+// MySQL.
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"1213":  true, // ER_LOCK_DEADLOCK
+}
+
+// transientError returns the migration that failed on a transient error,
+// along with the code of the error. Migrations marked notransaction are not
+// retried, as they may have been partially applied.
+func transientError(err error, dir migrate.MigrationDirection) (*migrate.TxError, string, bool) {
+	var txErr *migrate.TxError
+	if !errors.As(err, &txErr) {
+		return nil, "", false
+	}
+	m := txErr.Migration
+	if (dir == migrate.Up && m.DisableTransactionUp) || (dir == migrate.Down && m.DisableTransactionDown) {
+		return nil, "", false
+	}
+
+	code := errorCode(txErr.Err)
+	if !transientCodes[code] {
+		return nil, "", false
+	}
+	return txErr, code, true
+}
+
+// errorCode returns the SQLSTATE of a Postgres error, or the number of a
+// MySQL error.
+func errorCode(err error) string {
+	var pqErr *pq.Error
+	var pgErr *pgconn.PgError
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &pqErr):
+		return string(pqErr.Code)
+	case errors.As(err, &pgErr):
+		return pgErr.Code
+	case errors.As(err, &mysqlErr):
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+	return ""
+}
+
+// execWithRetry runs exec again when it fails on a transient error, up to
+// retries times. The transaction of the failed migration was rolled back by
+// then, so the next attempt starts over with it. exec is given the number
+// of migrations applied by the previous attempts, and returns the number it
+// applied itself.
+func execWithRetry(ctx context.Context, retries int, backoff time.Duration, dir migrate.MigrationDirection, exec func(applied int) (int, error)) (int, error) {
+	applied := 0
+	for attempt := 0; ; attempt++ {
+		n, err := exec(applied)
+		applied += n
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return applied, err
+		}
+
+		txErr, code, ok := transientError(err, dir)
+		if !ok {
+			return applied, err
+		}
+
+		ui.Warn(fmt.Sprintf("Migration %s failed with error %s, retrying in %s (%d of %d)", txErr.Migration.Id, code, backoff, attempt+1, retries))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return applied, err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type RetrySuite struct {
+	previous cli.Ui
+	ui       *cli.MockUi
+}
+
+var _ = Suite(&RetrySuite{})
+
+func (s *RetrySuite) SetUpTest(*C) {
+	s.previous = ui
+	s.ui = cli.NewMockUi()
+	ui = s.ui
+	retryBackoff = time.Millisecond
+}
+
+func (s *RetrySuite) TearDownTest(*C) {
+	ui = s.previous
+	retryBackoff = time.Second
+}
+
+func (*RetrySuite) TestTransientError(c *C) {
+	m := &migrate.Migration{Id: "2_index.sql", DisableTransactionDown: true}
+	tests := []struct {
+		err  error
+		dir  migrate.MigrationDirection
+		code string
+	}{
+		{&migrate.TxError{Migration: m, Err: &pq.Error{Code: "40001"}}, migrate.Up, "40001"},
+		{&migrate.TxError{Migration: m, Err: &pgconn.PgError{Code: "40P01"}}, migrate.Up, "40P01"},
+		{&migrate.TxError{Migration: m, Err: &mysql.MySQLError{Number: 1213}}, migrate.Up, "1213"},
+		{fmt.Errorf("Migration failed: %w", &migrate.TxError{Migration: m, Err: &pq.Error{Code: "40001"}}), migrate.Up, "40001"},
+		// Partially applied without a transaction.
+		{&migrate.TxError{Migration: m, Err: &pq.Error{Code: "40001"}}, migrate.Down, ""},
+		{&migrate.TxError{Migration: m, Err: &pq.Error{Code: "42P07"}}, migrate.Up, ""},
+		{&migrate.TxError{Migration: m, Err: &mysql.MySQLError{Number: 1050}}, migrate.Up, ""},
+		{&pq.Error{Code: "40001"}, migrate.Up, ""},
+	}
+	for _, t := range tests {
+		_, code, ok := transientError(t.err, t.dir)
+		c.Assert(ok, Equals, t.code != "", Commentf("%v", t.err))
+		c.Assert(code, Equals, t.code, Commentf("%v", t.err))
+	}
+}
+
+func (s *RetrySuite) TestExecWithRetry(c *C) {
+	m := &migrate.Migration{Id: "2_index.sql"}
+	deadlock := &migrate.TxError{Migration: m, Err: &pq.Error{Code: "40P01"}}
+
+	// The first attempt applies a migration before the deadlock, the second
+	// one goes through.
+	var given []int
+	n, err := execWithRetry(context.Background(), 2, retryBackoff, migrate.Up, func(applied int) (int, error) {
+		given = append(given, applied)
+		if len(given) == 1 {
+			return 1, deadlock
+		}
+		return 2, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(given, DeepEquals, []int{0, 1})
+	c.Assert(s.ui.ErrorWriter.String(), Equals, "Migration 2_index.sql failed with error 40P01, retrying in 1ms (1 of 2)\n")
+
+	attempts := 0
+	_, err = execWithRetry(context.Background(), 2, retryBackoff, migrate.Up, func(int) (int, error) {
+		attempts++
+		return 0, deadlock
+	})
+	c.Assert(err, Equals, deadlock)
+	c.Assert(attempts, Equals, 3)
+
+	// Not retried without retries, or on other errors.
+	attempts = 0
+	_, err = execWithRetry(context.Background(), 0, retryBackoff, migrate.Up, func(int) (int, error) {
+		attempts++
+		return 0, deadlock
+	})
+	c.Assert(err, Equals, deadlock)
+	c.Assert(attempts, Equals, 1)
+
+	failure := errors.New("syntax error")
+	_, err = execWithRetry(context.Background(), 2, retryBackoff, migrate.Up, func(int) (int, error) {
+		attempts++
+		return 0, failure
+	})
+	c.Assert(err, Equals, failure)
+	c.Assert(attempts, Equals, 2)
+}
+
+func (*ConfigSuite) TestGetEnvironmentRetries(c *C) {
+	writeConfig(c, `
+development:
+  dialect: postgres
+  datasource: postgres://localhost/app
+  retries: 3
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Retries, Equals, 3)
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  retries: 3
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "retries is not supported for dialect sqlite3")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// secretResolver fetches the secret a data source refers to, such as
+// awssecret://my/secret/id or vault://database/creds/app.
+type secretResolver func(ctx context.Context, ref string) (string, error)
+
+// secretResolvers holds the resolvers compiled in, keyed by URL scheme.
+// Integrations with heavy dependencies register themselves from files
+// guarded by a build tag.
+var secretResolvers = map[string]secretResolver{}
+
+// secretSchemes maps the supported secret schemes to the build tag that
+// enables them, empty when always compiled in.
+var secretSchemes = map[string]string{
+	"awssecret": "aws",
+	"vault":     "",
+}
+
+// secretScheme returns the scheme of a data source referring to a secret,
+// or an empty string for regular data sources.
+func secretScheme(dataSource string) string {
+	scheme, _, ok := strings.Cut(dataSource, "://")
+	if !ok {
+		return ""
+	}
+	if _, known := secretSchemes[scheme]; !known {
+		return ""
+	}
+	return scheme
+}
+
+// ResolveSecret replaces a data source referring to a secret by the
+// contents of that secret.
+//
+// A secret holding a JSON object (like the ones managed by RDS) fills in
+// the discrete connection settings: username, password, host, port and
+// dbname. Settings from the config file are used for anything missing
+// from the secret. Any other secret is used as the data source itself.
+func ResolveSecret(ctx context.Context, env *Environment) error {
+	scheme := secretScheme(env.DataSource)
+	resolve, ok := secretResolvers[scheme]
+	if !ok {
+		return fmt.Errorf("%s data sources are not supported by this build, rebuild with -tags %s", scheme, secretSchemes[scheme])
+	}
+
+	secret, err := resolve(ctx, strings.TrimPrefix(env.DataSource, scheme+"://"))
+	if err != nil {
+		return fmt.Errorf("cannot fetch secret: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		env.DataSource = strings.TrimSpace(secret)
+		return nil
+	}
+
+	env.DataSource = ""
+	setSecretField(&env.User, fields, "username", "user")
+	setSecretField(&env.Password, fields, "password")
+	setSecretField(&env.Host, fields, "host")
+	setSecretField(&env.Port, fields, "port")
+	setSecretField(&env.DBName, fields, "dbname", "database")
+
+	env.DataSource, err = BuildDataSource(env)
+	return err
+}
+
+func setSecretField(field *string, fields map[string]interface{}, keys ...string) {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			*field = v
+			return
+		case float64:
+			*field = fmt.Sprintf("%g", v)
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// ShardParallel is the number of shards migrated at once, set with
+// -parallel.
+var ShardParallel = 1
+
+type shardResult struct {
+	n   int
+	err error
+}
+
+// applyShardMigrations migrates each shard of the environment, carrying on
+// past the ones that fail. It returns the number of migrations applied on
+// all shards, and an error when any of them failed.
+func applyShardMigrations(ctx context.Context, env *Environment, dir migrate.MigrationDirection, dryrun bool, limit int, version int64, target string) (int, error) {
+	if ShardParallel < 1 {
+		return 0, errors.New("-parallel must be at least 1")
+	}
+	// Each shard would overwrite the file of the previous one.
+	if OutFile != "" {
+		return 0, errors.New("-out cannot be used with shards")
+	}
+	if MetricsFile != "" {
+		return 0, errors.New("-metrics-file cannot be used with shards")
+	}
+
+	if !dryrun {
+		var action string
+		if dir == migrate.Down {
+			action = fmt.Sprintf("Roll back migrations on %d shards", len(env.Shards))
+		} else if env.ConfirmUp {
+			action = fmt.Sprintf("Apply migrations on %d shards", len(env.Shards))
+		}
+		if action != "" {
+			if err := confirmProduction(env, action); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// The statements of a dry run are printed, they would get mixed up.
+	parallel := ShardParallel
+	if dryrun {
+		parallel = 1
+	}
+
+	results := make([]shardResult, len(env.Shards))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, dataSource := range env.Shards {
+		shard := shardEnvironment(env, dataSource)
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ui.Output(fmt.Sprintf("==> Shard %d of %d: %s", i+1, len(env.Shards), MaskDataSource(shard.DataSource)))
+			n, err := applyMigrations(ctx, shard, dir, dryrun, limit, version, target)
+			results[i] = shardResult{n: n, err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	total, failed := 0, 0
+	for i, r := range results {
+		total += r.n
+		if r.err != nil {
+			failed++
+			ui.Error(fmt.Sprintf("Shard %d (%s) failed: %s", i+1, MaskDataSource(env.Shards[i]), r.err))
+		}
+	}
+	if failed > 0 {
+		return total, fmt.Errorf("%d of %d shards failed", failed, len(env.Shards))
+	}
+	return total, nil
+}
+
+// shardEnvironment returns a copy of the environment connecting to one of
+// its shards. The confirmation was asked once for all of them.
+func shardEnvironment(env *Environment, dataSource string) *Environment {
+	shard := *env
+	shard.DataSource = dataSource
+	shard.Shards = nil
+	shard.Production = false
+	shard.ConfirmUp = false
+	return &shard
+}
+
+// describeDataSource returns the masked data source of the environment, or
+// the number of its shards.
+func describeDataSource(env *Environment) string {
+	if len(env.Shards) > 0 {
+		return fmt.Sprintf("%d shards", len(env.Shards))
+	}
+	return MaskDataSource(env.DataSource)
+}
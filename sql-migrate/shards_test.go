@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestGetEnvironmentShards(c *C) {
+	defer setenv("SHARD_DIR", "/data")()
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  shards:
+    - ${SHARD_DIR}/one.db
+    - ${SHARD_DIR}/two.db
+`)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Shards, DeepEquals, []string{"/data/one.db", "/data/two.db"})
+	c.Assert(describeDataSource(env), Equals, "2 shards")
+
+	_, _, err = GetConnection(env)
+	c.Assert(err, ErrorMatches, "The environment has shards, which only up and down support")
+
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  shards:
+    - one.db
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "Specify either shards or a data source, not both")
+}
+
+func (*ConfigSuite) TestApplyMigrationsShards(c *C) {
+	dir := c.MkDir()
+	shards := []string{filepath.Join(dir, "one.db"), filepath.Join(dir, "missing", "two.db"), filepath.Join(dir, "three.db")}
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  dir: ../test-migrations
+  table: shard_migrations
+  shards:
+    - `+shards[0]+`
+    - `+shards[1]+`
+    - `+shards[2]+`
+`)
+	ShardParallel = 2
+	defer func() { ShardParallel = 1 }()
+
+	// The second shard cannot be opened, the others are migrated anyway.
+	n, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "1 of 3 shards failed")
+	c.Assert(n, Equals, 4)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	for _, dataSource := range []string{shards[0], shards[2]} {
+		shard := shardEnvironment(env, dataSource)
+		db, dialect, err := GetConnection(shard)
+		c.Assert(err, IsNil)
+		applied, err := appliedMigrationIds(db, dialect, shard)
+		c.Assert(err, IsNil)
+		c.Assert(applied, HasLen, 2)
+		c.Assert(db.Close(), IsNil)
+	}
+
+	MetricsFile = filepath.Join(dir, "metrics.prom")
+	defer func() { MetricsFile = "" }()
+	_, err = ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "-metrics-file cannot be used with shards")
+}
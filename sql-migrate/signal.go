@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// errInterrupted is the cause of the cancellation of the command context on
+// SIGINT or SIGTERM, errDeadline once SQL_MIGRATE_DEADLINE has passed.
+var (
+	errInterrupted = errors.New("interrupted")
+	errDeadline    = errors.New("deadline exceeded")
+)
+
+// interruptContext returns the context of a command that changes the
+// database. It is cancelled on SIGINT or SIGTERM, and at the deadline given
+// by SQL_MIGRATE_DEADLINE, so that the migration in progress is rolled back
+// instead of abandoned along with its connection. A second signal exits
+// right away.
+func interruptContext() (context.Context, func(), error) {
+	deadline, ok, err := migrationDeadline(time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancelDeadline := context.CancelFunc(func() {})
+	if ok {
+		// It overrides -timeout, which sees the deadline on the context.
+		ctx, cancelDeadline = context.WithDeadlineCause(ctx, deadline, errDeadline)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			ui.Warn(fmt.Sprintf("Received %s, stopping after rolling back the migration in progress. Interrupt again to exit right away.", sig))
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancelDeadline()
+		cancel(nil)
+	}, nil
+}
+
+// interrupted reports whether the command was interrupted by a signal, or
+// reached its deadline.
+func interrupted(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.Is(cause, errInterrupted) || errors.Is(cause, errDeadline)
+}
+
+// interruptionReason starts the messages of an interrupted command.
+func interruptionReason(ctx context.Context) string {
+	if errors.Is(context.Cause(ctx), errDeadline) {
+		return "Deadline exceeded (SQL_MIGRATE_DEADLINE)"
+	}
+	return "Interrupted"
+}
+
+// interruptedError describes where the command stopped, after applied
+// migrations, err being the error the migration was stopped with.
+func interruptedError(ctx context.Context, err error, dir migrate.MigrationDirection, applied int) error {
+	reason := interruptionReason(ctx)
+	before := fmt.Sprintf("%d migrations were applied", applied)
+	switch applied {
+	case 0:
+		before = "no migration was applied"
+	case 1:
+		before = "1 migration was applied"
+	}
+
+	var txErr *migrate.TxError
+	if !errors.As(err, &txErr) {
+		return fmt.Errorf("%s, %s", reason, before)
+	}
+
+	m := txErr.Migration
+	if (dir == migrate.Up && m.DisableTransactionUp) || (dir == migrate.Down && m.DisableTransactionDown) {
+		return fmt.Errorf("%s during migration %s (%s), which runs without a transaction and may be partially applied, %s before it", reason, m.Id, directionName(dir), before)
+	}
+	return fmt.Errorf("%s during migration %s (%s), which was rolled back, %s before it", reason, m.Id, directionName(dir), before)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type SignalSuite struct{}
+
+var _ = Suite(&SignalSuite{})
+
+func (*SignalSuite) TestInterruptContext(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+
+	ctx, stop, err := interruptContext()
+	c.Assert(err, IsNil)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	c.Assert(err, IsNil)
+	if err := p.Signal(os.Interrupt); err != nil {
+		c.Skip("cannot send an interrupt: " + err.Error())
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		c.Fatal("the context was not cancelled")
+	}
+	c.Assert(interrupted(ctx), Equals, true)
+	c.Assert(mock.ErrorWriter.String(), Matches, "Received interrupt, stopping after rolling back the migration in progress.*\n")
+
+	ctx, stop, err = interruptContext()
+	c.Assert(err, IsNil)
+	stop()
+	c.Assert(interrupted(ctx), Equals, false)
+}
+
+func (*SignalSuite) TestInterruptedError(c *C) {
+	m := &migrate.Migration{Id: "3_index.sql", DisableTransactionDown: true}
+	txErr := &migrate.TxError{Migration: m, Err: context.Canceled}
+
+	c.Assert(interruptedError(context.Background(), txErr, migrate.Up, 2), ErrorMatches, `Interrupted during migration 3_index.sql \(up\), which was rolled back, 2 migrations were applied before it`)
+	c.Assert(interruptedError(context.Background(), txErr, migrate.Down, 1), ErrorMatches, `Interrupted during migration 3_index.sql \(down\), which runs without a transaction and may be partially applied, 1 migration was applied before it`)
+	c.Assert(interruptedError(context.Background(), context.Canceled, migrate.Up, 0), ErrorMatches, "Interrupted, no migration was applied")
+}
+
+func (*ConfigSuite) TestApplyMigrationsInterrupted(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+  table: interrupted_migrations
+`)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errInterrupted)
+	_, err := ApplyMigrations(ctx, migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "Interrupted, no migration was applied")
+
+	// Cancelled for another reason, the error is kept.
+	ctx, cancel = context.WithCancelCause(context.Background())
+	cancel(errors.New("shutting down"))
+	_, err = ApplyMigrations(ctx, migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "cannot ping database: context canceled")
+}
+
+func (*SignalSuite) TestMigrationDeadline(c *C) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	defer setenv("SQL_MIGRATE_DEADLINE", "")()
+	_, ok, err := migrationDeadline(now)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	defer setenv("SQL_MIGRATE_DEADLINE", "2024-05-01T12:30:00+02:00")()
+	deadline, ok, err := migrationDeadline(now)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	c.Assert(deadline.Equal(time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)), Equals, true)
+
+	defer setenv("SQL_MIGRATE_DEADLINE", "10m")()
+	deadline, _, err = migrationDeadline(now)
+	c.Assert(err, IsNil)
+	c.Assert(deadline, Equals, now.Add(10*time.Minute))
+
+	for _, value := range []string{"tomorrow", "-5m"} {
+		defer setenv("SQL_MIGRATE_DEADLINE", value)()
+		_, _, err = interruptContext()
+		c.Assert(err, ErrorMatches, `invalid SQL_MIGRATE_DEADLINE ".*", use an RFC3339 time or a positive duration such as 10m`)
+	}
+}
+
+func (*SignalSuite) TestInterruptContextDeadline(c *C) {
+	defer setenv("SQL_MIGRATE_DEADLINE", "20ms")()
+	ctx, stop, err := interruptContext()
+	c.Assert(err, IsNil)
+	defer stop()
+
+	// -timeout doesn't shorten or extend it.
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = time.Hour
+	connect, cancel := timeoutContext(ctx, &Environment{})
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	connectDeadline, _ := connect.Deadline()
+	c.Assert(connectDeadline, Equals, deadline)
+
+	<-ctx.Done()
+	c.Assert(interrupted(ctx), Equals, true)
+	m := &migrate.Migration{Id: "3_index.sql"}
+	c.Assert(interruptedError(ctx, &migrate.TxError{Migration: m, Err: context.DeadlineExceeded}, migrate.Up, 1), ErrorMatches, `Deadline exceeded \(SQL_MIGRATE_DEADLINE\) during migration 3_index.sql \(up\), which was rolled back, 1 migration was applied before it`)
+}
+
+func (*ConfigSuite) TestApplyMigrationsDeadline(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  dir: ../test-migrations
+`)
+
+	defer setenv("SQL_MIGRATE_DEADLINE", time.Now().Add(-time.Minute).Format(time.RFC3339))()
+	ctx, stop, err := interruptContext()
+	c.Assert(err, IsNil)
+	defer stop()
+	_, err = ApplyMigrations(ctx, migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, `Deadline exceeded \(SQL_MIGRATE_DEADLINE\), no migration was applied`)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// embeddedMigrations holds the migrations compiled into the binary, it is
+// only set when building with -tags embed.
+var embeddedMigrations *embed.FS
+
+// defaultSource is the source used when the environment sets none. Binaries
+// built with -tags embed default to their embedded migrations.
+var defaultSource = "file"
+
+// validateSource checks the source of the environment, which must be file
+// (a directory on disk) or embed (the migrations compiled into the binary).
+func validateSource(env *Environment) error {
+	if err := validateRemoteDir(env); err != nil {
+		return err
+	}
+
+	switch env.Source {
+	case "", "file":
+		return nil
+	case "embed":
+		if embeddedMigrations == nil {
+			return errors.New("source embed requires a binary built with -tags embed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown source %q, use file or embed", env.Source)
+	}
+}
+
+// migrationSource returns the source to read the migrations of the
+// environment from. In both cases Dir is the directory holding them, on disk
+// or within the embedded filesystem. When dir is a list or a glob, the
+// migrations of all the directories are merged. With template, the files
+// are rendered with the vars of the environment.
+func migrationSource(env *Environment) migrate.MigrationSource {
+	var vars map[string]string
+	if env.Template {
+		vars = env.Vars
+		if vars == nil {
+			vars = map[string]string{}
+		}
+	}
+
+	patterns := env.Dirs
+	if len(patterns) == 0 {
+		patterns = []string{env.Dir}
+	}
+	var source migrate.MigrationSource
+	if len(patterns) > 1 || isDirPattern(patterns[0]) {
+		source = &dirsMigrationSource{patterns: patterns, embedded: env.Source == "embed", vars: vars}
+	} else {
+		source = dirMigrationSource(env.Source == "embed", env.Dir, vars)
+	}
+
+	if ordering := migrationOrdering(env); ordering != migrate.LexicalOrdering {
+		return &orderedMigrationSource{MigrationSource: source, ordering: ordering}
+	}
+	return source
+}
+
+// migrationOrdering returns the ordering setting of the environment.
+// Validation leaves only lexical and numeric.
+func migrationOrdering(env *Environment) migrate.MigrationOrdering {
+	if env.Ordering == "numeric" {
+		return migrate.NumericOrdering
+	}
+	return migrate.LexicalOrdering
+}
+
+// orderedMigrationSource sorts the migrations of a source in another
+// ordering than the default one of the sources.
+type orderedMigrationSource struct {
+	migrate.MigrationSource
+	ordering migrate.MigrationOrdering
+}
+
+func (s *orderedMigrationSource) FindMigrations() ([]*migrate.Migration, error) {
+	migrations, err := s.MigrationSource.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	migrate.SortMigrations(migrations, s.ordering)
+	return migrations, nil
+}
+
+// dirMigrationSource reads the migrations of a directory, rendering them as
+// templates when vars is not nil.
+func dirMigrationSource(embedded bool, dir string, vars map[string]string) migrate.MigrationSource {
+	if vars != nil {
+		return &templateMigrationSource{embedded: embedded, dir: dir, vars: vars}
+	}
+	if embedded {
+		return migrate.EmbedFileSystemMigrationSource{
+			FileSystem: *embeddedMigrations,
+			Root:       dir,
+		}
+	}
+	return migrate.FileMigrationSource{
+		Dir: dir,
+	}
+}
+
+// isDirPattern reports whether a dir is a glob pattern.
+func isDirPattern(dir string) bool {
+	return strings.ContainsAny(dir, "*?[")
+}
+
+// dirsMigrationSource merges the migrations of several directories, given
+// as directories or glob patterns matching directories.
+type dirsMigrationSource struct {
+	patterns []string
+	embedded bool
+	vars     map[string]string
+
+	// files maps the id of each migration found to its file.
+	files map[string]string
+}
+
+func (s *dirsMigrationSource) FindMigrations() ([]*migrate.Migration, error) {
+	dirs, err := s.dirs()
+	if err != nil {
+		return nil, err
+	}
+
+	s.files = make(map[string]string)
+	found := make(map[string]string)
+	var migrations []*migrate.Migration
+	for _, dir := range dirs {
+		dirMigrations, err := dirMigrationSource(s.embedded, dir, s.vars).FindMigrations()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range dirMigrations {
+			if other, ok := found[m.Id]; ok {
+				return nil, fmt.Errorf("Migration %s is both in %s and %s", m.Id, other, dir)
+			}
+			found[m.Id] = dir
+			s.files[m.Id] = path.Join(dir, m.Id)
+		}
+		migrations = append(migrations, dirMigrations...)
+	}
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Less(migrations[j])
+	})
+	return migrations, nil
+}
+
+// dirs expands the patterns into the directories they match, in order.
+func (s *dirsMigrationSource) dirs() ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		matches := []string{pattern}
+		if isDirPattern(pattern) {
+			var err error
+			matches, err = s.glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid dir %s: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("dir %s matches no directories", pattern)
+			}
+		}
+
+		for _, dir := range matches {
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// glob returns the directories matching the pattern, sorted.
+func (s *dirsMigrationSource) glob(pattern string) ([]string, error) {
+	var matches []string
+	var err error
+	if s.embedded {
+		matches, err = fs.Glob(*embeddedMigrations, pattern)
+	} else {
+		matches, err = filepath.Glob(pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := matches[:0]
+	for _, match := range matches {
+		var info fs.FileInfo
+		if s.embedded {
+			info, err = fs.Stat(*embeddedMigrations, match)
+		} else {
+			info, err = os.Stat(match)
+		}
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, match)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// migrationFile returns the file a migration was read from, for display.
+func migrationFile(env *Environment, source migrate.MigrationSource, id string) string {
+	if s, ok := source.(*orderedMigrationSource); ok {
+		source = s.MigrationSource
+	}
+	if s, ok := source.(*dirsMigrationSource); ok && s.files[id] != "" {
+		return s.files[id]
+	}
+	return path.Join(env.Dir, id)
+}
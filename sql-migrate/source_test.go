@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type SourceSuite struct{}
+
+var _ = Suite(&SourceSuite{})
+
+func writeMigration(c *C, dir, name string) {
+	c.Assert(os.MkdirAll(dir, 0o755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, name), []byte("-- +migrate Up\nSELECT 1;\n"), 0o644), IsNil)
+}
+
+func migrationIds(migrations []*migrate.Migration) []string {
+	ids := make([]string, 0, len(migrations))
+	for _, m := range migrations {
+		ids = append(ids, m.Id)
+	}
+	return ids
+}
+
+func (*SourceSuite) TestSingleDir(c *C) {
+	source := migrationSource(&Environment{Dir: "migrations", Dirs: []string{"migrations"}})
+	c.Assert(source, DeepEquals, migrate.FileMigrationSource{Dir: "migrations"})
+}
+
+func (*SourceSuite) TestMergeDirs(c *C) {
+	root := c.MkDir()
+	writeMigration(c, filepath.Join(root, "common"), "1_initial.sql")
+	writeMigration(c, filepath.Join(root, "common"), "10_users.sql")
+	writeMigration(c, filepath.Join(root, "tenant-a"), "2_tenant_a.sql")
+	writeMigration(c, filepath.Join(root, "tenant-b"), "3_tenant_b.sql")
+	writeMigration(c, filepath.Join(root, "other"), "4_other.sql")
+
+	env := &Environment{Dirs: []string{filepath.Join(root, "common"), filepath.Join(root, "tenant-*")}}
+	source := migrationSource(env)
+	migrations, err := source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrationIds(migrations), DeepEquals, []string{"1_initial.sql", "2_tenant_a.sql", "3_tenant_b.sql", "10_users.sql"})
+	c.Assert(migrationFile(env, source, "2_tenant_a.sql"), Equals, filepath.Join(root, "tenant-a", "2_tenant_a.sql"))
+}
+
+func (*SourceSuite) TestDuplicateIds(c *C) {
+	root := c.MkDir()
+	writeMigration(c, filepath.Join(root, "a"), "1_initial.sql")
+	writeMigration(c, filepath.Join(root, "b"), "1_initial.sql")
+
+	_, err := migrationSource(&Environment{Dir: filepath.Join(root, "*")}).FindMigrations()
+	c.Assert(err, ErrorMatches, "Migration 1_initial.sql is both in .*/a and .*/b")
+}
+
+func (*SourceSuite) TestGlobWithoutMatch(c *C) {
+	root := c.MkDir()
+	writeMigration(c, root, "1_initial.sql")
+
+	// Files matching the pattern are not directories.
+	_, err := migrationSource(&Environment{Dir: filepath.Join(root, "*.sql")}).FindMigrations()
+	c.Assert(err, ErrorMatches, "dir .*/\\*.sql matches no directories")
+}
+
+func (*SourceSuite) TestNumericOrdering(c *C) {
+	root := c.MkDir()
+	writeMigration(c, filepath.Join(root, "legacy"), "v10_users.sql")
+	writeMigration(c, filepath.Join(root, "legacy"), "v9_roles.sql")
+	writeMigration(c, filepath.Join(root, "current"), "v11_orders.sql")
+
+	env := &Environment{Dir: filepath.Join(root, "legacy")}
+	migrations, err := migrationSource(env).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrationIds(migrations), DeepEquals, []string{"v10_users.sql", "v9_roles.sql"})
+
+	env.Ordering = "numeric"
+	migrations, err = migrationSource(env).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrationIds(migrations), DeepEquals, []string{"v9_roles.sql", "v10_users.sql"})
+
+	env = &Environment{Dirs: []string{filepath.Join(root, "legacy"), filepath.Join(root, "current")}, Ordering: "numeric"}
+	source := migrationSource(env)
+	migrations, err = source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrationIds(migrations), DeepEquals, []string{"v9_roles.sql", "v10_users.sql", "v11_orders.sql"})
+	c.Assert(migrationFile(env, source, "v11_orders.sql"), Equals, filepath.Join(root, "current", "v11_orders.sql"))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// simplePragma matches a PRAGMA statement setting or reading a single
+// pragma, such as PRAGMA foreign_keys=ON or PRAGMA main.journal_mode = WAL.
+var simplePragma = regexp.MustCompile(`(?i)^PRAGMA\s+(\w+\.)?\w+(\s*=\s*(-?\w+|'[^';]*')|\s*\(\s*(-?\w+|'[^';]*')\s*\))?\s*;?$`)
+
+func checkPragmas(pragmas []string) error {
+	for _, pragma := range pragmas {
+		if !simplePragma.MatchString(pragma) {
+			return fmt.Errorf("pragma %q is not a simple PRAGMA statement, such as PRAGMA foreign_keys=ON", pragma)
+		}
+	}
+	return nil
+}
+
+// sqliteConnector opens SQLite connections with the pragmas of the
+// environment applied, as most of them only last for the connection and
+// database/sql opens new ones as needed.
+type sqliteConnector struct {
+	driver     *sqlite3.SQLiteDriver
+	dataSource string
+}
+
+func newSqliteConnector(dataSource string, pragmas []string) *sqliteConnector {
+	return &sqliteConnector{
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("cannot apply %s: %w", pragma, err)
+					}
+				}
+				return nil
+			},
+		},
+		dataSource: dataSource,
+	}
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dataSource)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
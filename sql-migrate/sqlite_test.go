@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestCheckPragmas(c *C) {
+	c.Assert(checkPragmas([]string{
+		"PRAGMA foreign_keys=ON",
+		"pragma main.journal_mode = WAL;",
+		"PRAGMA busy_timeout(5000)",
+		"PRAGMA cache_size = -2000",
+		"PRAGMA encoding = 'UTF-8'",
+	}), IsNil)
+
+	for _, pragma := range []string{"foreign_keys=ON", "PRAGMA foreign_keys=ON; DROP TABLE users", "PRAGMA journal_mode = 'WAL"} {
+		c.Assert(checkPragmas([]string{pragma}), ErrorMatches, `pragma ".*" is not a simple PRAGMA statement, such as PRAGMA foreign_keys=ON`)
+	}
+}
+
+func (*ConfigSuite) TestGetConnectionPragmas(c *C) {
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(c.MkDir(), "test.db")+`
+  pragmas:
+    - PRAGMA foreign_keys=ON
+    - PRAGMA journal_mode=WAL
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	db, _, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// Applied on every connection of the pool.
+	db.SetMaxIdleConns(0)
+	for i := 0; i < 2; i++ {
+		var foreignKeys int
+		c.Assert(db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys), IsNil)
+		c.Assert(foreignKeys, Equals, 1)
+	}
+	var journalMode string
+	c.Assert(db.QueryRow("PRAGMA journal_mode").Scan(&journalMode), IsNil)
+	c.Assert(journalMode, Equals, "wal")
+
+	writeConfig(c, `
+development:
+  dialect: postgres
+  datasource: postgres://localhost/app
+  pragmas:
+    - PRAGMA foreign_keys=ON
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "pragmas is not supported for dialect postgres")
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SshSettings describe the bastion host to tunnel the database connection
+// through.
+type SshSettings struct {
+	// Host is the bastion, host or host:port, the port defaults to 22.
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+
+	// Key is the private key file, the keys of the agent listening on
+	// SSH_AUTH_SOCK are used when it is not set.
+	Key string `yaml:"key"`
+
+	// KnownHosts is the file the host key of the bastion is checked
+	// against, ~/.ssh/known_hosts by default.
+	KnownHosts string `yaml:"knownhosts"`
+}
+
+// sshTunnel forwards the connections made to a local port to the database,
+// through the bastion.
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	target   string
+}
+
+// sshTunnels are the tunnels opened by the command, closed when it exits.
+var (
+	sshTunnelsMu sync.Mutex
+	sshTunnels   []*sshTunnel
+)
+
+// closeSshTunnels tears down the tunnels opened by the command.
+func closeSshTunnels() {
+	sshTunnelsMu.Lock()
+	defer sshTunnelsMu.Unlock()
+	for _, t := range sshTunnels {
+		_ = t.Close()
+	}
+	sshTunnels = nil
+}
+
+// withSshTunnel opens a tunnel to the database of the environment through
+// its bastion, and returns a copy of the environment whose data source
+// points at the local end of the tunnel.
+func withSshTunnel(ctx context.Context, env *Environment) (*Environment, error) {
+	target, err := sshTarget(env.Dialect, env.DataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnel, err := openSshTunnel(ctx, env.Ssh, target)
+	if err != nil {
+		return nil, err
+	}
+	sshTunnelsMu.Lock()
+	sshTunnels = append(sshTunnels, tunnel)
+	sshTunnelsMu.Unlock()
+
+	dataSource, err := tunnelDataSource(env.Dialect, env.DataSource, tunnel.listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	tunneled := *env
+	tunneled.DataSource = dataSource
+	return &tunneled, nil
+}
+
+// openSshTunnel connects to the bastion and starts forwarding a local port
+// to the target, as seen from the bastion.
+func openSshTunnel(ctx context.Context, settings *SshSettings, target string) (*sshTunnel, error) {
+	config, err := sshClientConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := settings.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the ssh host %s: %w", addr, err)
+	}
+	// The handshake doesn't take a context, the deadline bounds it.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("cannot connect to the ssh host %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	t := &sshTunnel{client: client, listener: listener, target: target}
+	go t.serve()
+	logger().Info("ssh tunnel opened", "host", addr, "target", target, "local", listener.Addr().String(), "duration", time.Since(start))
+	return t, nil
+}
+
+// sshClientConfig authenticates with the key file, or else the agent, and
+// checks the host key against the known hosts.
+func sshClientConfig(settings *SshSettings) (*ssh.ClientConfig, error) {
+	var auth ssh.AuthMethod
+	if settings.Key != "" {
+		key, err := os.ReadFile(settings.Key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the ssh key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, fmt.Errorf("the ssh key %s is protected by a passphrase, add it to ssh-agent and leave key out instead", settings.Key)
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot parse the ssh key %s: %w", settings.Key, err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("cannot reach the ssh agent: %w", err)
+		}
+		auth = ssh.PublicKeysCallback(agent.NewClient(conn).Signers)
+	} else {
+		return nil, errors.New("ssh needs a key, or an agent through SSH_AUTH_SOCK")
+	}
+
+	knownHosts := settings.KnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find the known hosts: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the known hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            settings.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	remote, err := t.client.Dial("tcp", t.target)
+	if err != nil {
+		logger().Warn("ssh tunnel cannot reach the database", "target", t.target, "error", err)
+		_ = local.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go pipe(remote, local)
+	go pipe(local, remote)
+	<-done
+	_ = local.Close()
+	_ = remote.Close()
+}
+
+func (t *sshTunnel) Close() error {
+	_ = t.listener.Close()
+	return t.client.Close()
+}
+
+// sshTarget returns the address of the database in the data source, which
+// the bastion connects to.
+func sshTarget(dialect, dataSource string) (string, error) {
+	switch driverName(dialect) {
+	case "mysql":
+		addr, err := mysqlTcpAddress(dataSource)
+		if err != nil {
+			return "", err
+		}
+		if addr == "" {
+			addr = "localhost"
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "3306")
+		}
+		return addr, nil
+	case "postgres":
+		var host, port string
+		if isPostgresURL(dataSource) {
+			u, err := url.Parse(dataSource)
+			if err != nil {
+				return "", err
+			}
+			host, port = u.Hostname(), u.Port()
+		}
+		if value, ok := postgresParam(dataSource, "host"); ok {
+			host = value
+		}
+		if value, ok := postgresParam(dataSource, "port"); ok {
+			port = value
+		}
+		if host == "" {
+			host = getenvDefault("PGHOST", "localhost")
+		}
+		if port == "" {
+			port = getenvDefault("PGPORT", "5432")
+		}
+		if strings.HasPrefix(host, "/") {
+			return "", errors.New("ssh cannot be used with a Unix socket")
+		}
+		if strings.Contains(host, ",") {
+			return "", errors.New("ssh cannot be used with several hosts")
+		}
+		return net.JoinHostPort(host, port), nil
+	case "mssql":
+		u, err := sqlServerURL(dataSource)
+		if err != nil {
+			return "", err
+		}
+		port := u.Port()
+		if port == "" {
+			port = "1433"
+		}
+		return net.JoinHostPort(u.Hostname(), port), nil
+	default:
+		return "", fmt.Errorf("ssh is not supported for dialect %s", dialect)
+	}
+}
+
+// tunnelDataSource points the data source at the local end of the tunnel.
+func tunnelDataSource(dialect, dataSource, local string) (string, error) {
+	switch driverName(dialect) {
+	case "mysql":
+		slash := strings.LastIndex(dataSource, "/")
+		at := strings.LastIndex(dataSource[:slash], "@")
+		return dataSource[:at+1] + "tcp(" + local + ")" + dataSource[slash:], nil
+	case "postgres":
+		host, port, err := net.SplitHostPort(local)
+		if err != nil {
+			return "", err
+		}
+		if isPostgresURL(dataSource) {
+			u, err := url.Parse(dataSource)
+			if err != nil {
+				return "", err
+			}
+			u.Host = local
+			q := u.Query()
+			q.Del("host")
+			q.Del("port")
+			u.RawQuery = q.Encode()
+			return u.String(), nil
+		}
+		if dataSource, err = addPostgresParam(dataSource, "host", host); err != nil {
+			return "", err
+		}
+		return addPostgresParam(dataSource, "port", port)
+	case "mssql":
+		u, err := sqlServerURL(dataSource)
+		if err != nil {
+			return "", err
+		}
+		u.Host = local
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("ssh is not supported for dialect %s", dialect)
+	}
+}
+
+// mysqlTcpAddress returns the address of a MySQL data source, the driver
+// reads it between the last @ and the last / of the data source.
+func mysqlTcpAddress(dataSource string) (string, error) {
+	slash := strings.LastIndex(dataSource, "/")
+	if slash < 0 {
+		return "", errors.New("ssh needs a MySQL data source with a /dbname part")
+	}
+	addr := dataSource[strings.LastIndex(dataSource[:slash], "@")+1 : slash]
+	if addr == "" {
+		return "", nil
+	}
+	network, rest, ok := strings.Cut(addr, "(")
+	if !ok || !strings.HasSuffix(rest, ")") {
+		return "", fmt.Errorf("cannot read the address %q of the MySQL data source", addr)
+	}
+	if network == "unix" {
+		return "", errors.New("ssh cannot be used with a Unix socket")
+	}
+	return strings.TrimSuffix(rest, ")"), nil
+}
+
+func sqlServerURL(dataSource string) (*url.URL, error) {
+	if !strings.HasPrefix(dataSource, "sqlserver://") {
+		return nil, errors.New("ssh needs a sqlserver:// data source")
+	}
+	u, err := url.Parse(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return nil, errors.New("ssh cannot be used with a SQL Server instance name, give the port instead")
+	}
+	return u, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"text/template"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// templateMigrationSource reads the migrations of a directory, on disk or
+// embedded, rendering each file as a Go template with the vars of the
+// environment before it is parsed.
+type templateMigrationSource struct {
+	embedded bool
+	dir      string
+	vars     map[string]string
+}
+
+func (s *templateMigrationSource) FindMigrations() ([]*migrate.Migration, error) {
+	var files http.FileSystem = http.Dir(s.dir)
+	if s.embedded {
+		sub, err := fs.Sub(*embeddedMigrations, s.dir)
+		if err != nil {
+			return nil, err
+		}
+		files = http.FS(sub)
+	}
+	return migrate.HttpFileSystemMigrationSource{
+		FileSystem: &templateFileSystem{files: files, vars: s.vars},
+	}.FindMigrations()
+}
+
+// templateFileSystem renders the .sql files it opens.
+type templateFileSystem struct {
+	files http.FileSystem
+	vars  map[string]string
+}
+
+func (t *templateFileSystem) Open(name string) (http.File, error) {
+	f, err := t.files.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".sql") {
+		return f, err
+	}
+
+	content, err := io.ReadAll(f)
+	if err == nil {
+		content, err = renderMigration(name, content, t.vars)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &renderedFile{File: f, content: bytes.NewReader(content)}, nil
+}
+
+// renderMigration executes the content of a migration file as a template.
+// Referring to a variable that is not set is an error.
+func renderMigration(name string, content []byte, vars map[string]string) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the template: %w", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return nil, fmt.Errorf("cannot render the template: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// renderedFile serves the rendered content in place of the file.
+type renderedFile struct {
+	http.File
+	content *bytes.Reader
+}
+
+func (f *renderedFile) Read(p []byte) (int, error) {
+	return f.content.Read(p)
+}
+
+func (f *renderedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.content.Seek(offset, whence)
+}
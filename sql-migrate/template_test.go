@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type TemplateSuite struct{}
+
+var _ = Suite(&TemplateSuite{})
+
+func writeTemplatedMigration(c *C, dir string) {
+	content := "-- +migrate Up\nCREATE TABLE people (id int) TABLESPACE {{.tablespace}};\n{{if eq .audit \"on\"}}CREATE TABLE people_audit (id int);\n{{end -}}\n-- +migrate Down\nDROP TABLE people;\n"
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_initial.sql"), []byte(content), 0o644), IsNil)
+}
+
+func (*TemplateSuite) TestTemplatedMigrations(c *C) {
+	dir := c.MkDir()
+	writeTemplatedMigration(c, dir)
+
+	env := &Environment{Dir: dir, Template: true, Vars: map[string]string{"tablespace": "fast", "audit": "on"}}
+	migrations, err := migrationSource(env).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Up, DeepEquals, []string{
+		"CREATE TABLE people (id int) TABLESPACE fast;\n",
+		"CREATE TABLE people_audit (id int);\n",
+	})
+	c.Assert(migrations[0].Down, DeepEquals, []string{"DROP TABLE people;\n"})
+
+	// The checksum follows the rendered statements.
+	sum := migrationChecksum(migrations[0])
+	env.Vars["tablespace"] = "slow"
+	migrations, err = migrationSource(env).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrationChecksum(migrations[0]), Not(Equals), sum)
+}
+
+func (*TemplateSuite) TestTemplateMissingVar(c *C) {
+	dir := c.MkDir()
+	writeTemplatedMigration(c, dir)
+
+	_, err := migrationSource(&Environment{Dir: dir, Template: true}).FindMigrations()
+	c.Assert(err, ErrorMatches, `Error while opening 1_initial.sql: cannot render the template: .*map has no entry for key "tablespace"`)
+}
+
+func (*TemplateSuite) TestTemplateDisabled(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_initial.sql"), []byte("-- +migrate Up\nCREATE TABLE people (id int) TABLESPACE {{.tablespace}};\n"), 0o644), IsNil)
+
+	migrations, err := migrationSource(&Environment{Dir: dir, Vars: map[string]string{"tablespace": "fast"}}).FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations[0].Up[0], Equals, "CREATE TABLE people (id int) TABLESPACE {{.tablespace}};\n")
+}
+
+func (*ConfigSuite) TestGetEnvironmentTemplate(c *C) {
+	defer setenv("SQL_MIGRATE_TEST_TABLESPACE", "fast")()
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  vars:
+    tablespace: ${SQL_MIGRATE_TEST_TABLESPACE}
+`)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Template, Equals, false)
+	c.Assert(env.Vars, DeepEquals, map[string]string{"tablespace": "fast"})
+
+	ConfigTemplate = true
+	env, err = GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Template, Equals, true)
+}
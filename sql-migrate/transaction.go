@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// SingleTransaction applies all the planned migrations, and records them,
+// in one transaction rather than one per migration, set with
+// -single-transaction.
+var SingleTransaction bool
+
+// checkSingleTransactionDialect refuses -single-transaction for the dialects
+// that commit schema changes implicitly, which would leave the database
+// partly migrated when a later migration fails. It is checked with the
+// configuration, before connecting.
+func checkSingleTransactionDialect(env *Environment) error {
+	if !transactionalDdl[driverName(env.Dialect)] {
+		return fmt.Errorf("-single-transaction is not supported for dialect %s, it commits schema changes implicitly", env.Dialect)
+	}
+	return nil
+}
+
+// checkSingleTransaction refuses -single-transaction for migrations marked
+// notransaction, for the same reason.
+func checkSingleTransaction(migrations []*migrate.PlannedMigration) error {
+	for _, m := range migrations {
+		if m.DisableTransaction {
+			return fmt.Errorf("Migration %s is marked notransaction, it cannot run with -single-transaction", m.Id)
+		}
+	}
+	return nil
+}
+
+// execSingleTransaction plans the migrations like the migration set does,
+// then applies them in a single transaction, so that a failure leaves the
+// database as it was. The migrations are reported to the MigrationApplied
+// hook of the set once the transaction is committed.
+func execSingleTransaction(ctx context.Context, db *sql.DB, dialect string, migrationSet migrate.MigrationSet, source migrate.MigrationSource, dir migrate.MigrationDirection, max int, version int64) (int, error) {
+	var migrations []*migrate.PlannedMigration
+	var dbMap *gorp.DbMap
+	var err error
+	if version >= 0 {
+		migrations, dbMap, err = migrationSet.PlanMigrationToVersion(db, dialect, source, dir, version)
+	} else {
+		migrations, dbMap, err = migrationSet.PlanMigration(db, dialect, source, dir, max)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := checkSingleTransaction(migrations); err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	tx, err := dbMap.Begin()
+	if err != nil {
+		return 0, &migrate.TxError{Migration: migrations[0].Migration, Err: err}
+	}
+	executor := tx.WithContext(ctx)
+
+	durations := make([]time.Duration, 0, len(migrations))
+	for _, m := range migrations {
+		start := time.Now()
+		err := ctx.Err()
+		for _, stmt := range m.Queries {
+			if err != nil {
+				break
+			}
+			err = execStatement(executor, m, trimStatement(stmt))
+		}
+		if err == nil {
+			if dir == migrate.Up {
+				err = executor.Insert(&migrate.MigrationRecord{Id: m.Id, AppliedAt: time.Now()})
+			} else {
+				_, err = executor.Delete(&migrate.MigrationRecord{Id: m.Id})
+			}
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, &migrate.TxError{Migration: m.Migration, Err: err}
+		}
+		durations = append(durations, time.Since(start))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, &migrate.TxError{Migration: migrations[len(migrations)-1].Migration, Err: err}
+	}
+
+	if migrationSet.MigrationApplied != nil {
+		for i, m := range migrations {
+			migrationSet.MigrationApplied(m, dir, durations[i])
+		}
+	}
+	return len(migrations), nil
+}
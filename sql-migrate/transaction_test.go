@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func (*ConfigSuite) TestCheckSingleTransaction(c *C) {
+	c.Assert(checkSingleTransactionDialect(&Environment{Dialect: "postgres"}), IsNil)
+	c.Assert(checkSingleTransactionDialect(&Environment{Dialect: "sqlite3"}), IsNil)
+	c.Assert(checkSingleTransactionDialect(&Environment{Dialect: "mysql"}), ErrorMatches,
+		"-single-transaction is not supported for dialect mysql, it commits schema changes implicitly")
+
+	migrations := []*migrate.PlannedMigration{
+		{Migration: &migrate.Migration{Id: "1_initial.sql"}},
+	}
+	c.Assert(checkSingleTransaction(migrations), IsNil)
+	migrations = append(migrations, &migrate.PlannedMigration{Migration: &migrate.Migration{Id: "2_index.sql"}, DisableTransaction: true})
+	c.Assert(checkSingleTransaction(migrations), ErrorMatches,
+		"Migration 2_index.sql is marked notransaction, it cannot run with -single-transaction")
+}
+
+func (*ConfigSuite) TestSingleTransactionDialectBeforeConnecting(c *C) {
+	SingleTransaction = true
+	defer func() { SingleTransaction = false }()
+
+	// Nothing listens on the port, the dialect is refused first.
+	writeConfig(c, `
+development:
+  dialect: mysql
+  datasource: root@tcp(127.0.0.1:1)/app
+  dir: ../test-migrations
+`)
+	_, err := ApplyMigrations(context.Background(), migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, "-single-transaction is not supported for dialect mysql, it commits schema changes implicitly")
+}
+
+func (*ConfigSuite) TestApplyMigrationsSingleTransaction(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	ui = cli.NewMockUi()
+	SingleTransaction = true
+	defer func() { SingleTransaction = false }()
+
+	dir := c.MkDir()
+	migrations := filepath.Join(dir, "migrations")
+	c.Assert(os.Mkdir(migrations, 0o755), IsNil)
+	writeMigration := func(name, up string) {
+		content := "-- +migrate Up\n" + up + "\n-- +migrate Down\nSELECT 1;\n"
+		c.Assert(os.WriteFile(filepath.Join(migrations, name), []byte(content), 0o644), IsNil)
+	}
+	writeMigration("1_people.sql", "CREATE TABLE people (id INT);")
+	writeMigration("2_broken.sql", "INSERT INTO missing VALUES (1);")
+	writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: `+filepath.Join(dir, "test.db")+`
+  dir: `+migrations+`
+`)
+
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	n, err := applyMigrations(context.Background(), env, migrate.Up, false, 0, -1, "")
+	c.Assert(err, ErrorMatches, `Migration failed, all the migrations were rolled back \(-single-transaction\): .*2_broken.sql.*`)
+	c.Assert(n, Equals, 0)
+
+	db, dialect, err := GetConnection(env)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	applied, err := appliedMigrationIds(db, dialect, env)
+	c.Assert(err, IsNil)
+	c.Assert(applied, HasLen, 0)
+	var tables int
+	c.Assert(db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'people'").Scan(&tables), IsNil)
+	c.Assert(tables, Equals, 0)
+
+	writeMigration("2_broken.sql", "INSERT INTO people VALUES (1);")
+	n, err = applyMigrations(context.Background(), env, migrate.Up, false, 0, -1, "")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	applied, err = appliedMigrationIds(db, dialect, env)
+	c.Assert(err, IsNil)
+	c.Assert(applied, DeepEquals, map[string]bool{"1_people.sql": true, "2_broken.sql": true})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	secretResolvers["vault"] = resolveVaultSecret
+}
+
+// vaultClient is used to talk to Vault, the request context bounds the time
+// spent waiting for it.
+var vaultClient = http.DefaultClient
+
+// vaultResponse holds the parts of a Vault read response that are used.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// resolveVaultSecret reads a secret from Vault, as configured by VAULT_ADDR
+// and VAULT_TOKEN. The reference is a path, such as database/creds/app for
+// dynamic database credentials, optionally followed by #field to use a
+// single field of the secret as the data source. Without a field the data
+// of the secret is returned as a JSON object, which fills in the connection
+// settings.
+func resolveVaultSecret(ctx context.Context, ref string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+
+	path, field, _ := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", errors.New("vault data source needs a secret path, such as vault://database/creds/app")
+	}
+
+	secret, err := readVaultSecret(ctx, addr, token, path)
+	if err != nil {
+		return "", err
+	}
+
+	if secret.LeaseID != "" {
+		logger().Info("vault lease obtained", "path", path, "duration", time.Duration(secret.LeaseDuration)*time.Second)
+	}
+
+	data := secret.Data
+	// KV version 2 nests the secret in data.data, next to its metadata.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	if field == "" {
+		out, err := json.Marshal(data)
+		return string(out), err
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+	return value, nil
+}
+
+func readVaultSecret(ctx context.Context, addr, token, path string) (*vaultResponse, error) {
+	endpoint, err := url.JoinPath(addr, "v1", path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAULT_ADDR %q: %w", addr, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach Vault at %s: %w", addr, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var secret vaultResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&secret)
+
+	if resp.StatusCode != http.StatusOK {
+		if len(secret.Errors) > 0 {
+			return nil, fmt.Errorf("cannot read %s from Vault (%s): %s", path, resp.Status, strings.Join(secret.Errors, ", "))
+		}
+		return nil, fmt.Errorf("cannot read %s from Vault (%s)", path, resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid response from Vault for %s: %w", path, decodeErr)
+	}
+	if len(secret.Data) == 0 {
+		return nil, fmt.Errorf("vault secret %s is empty", path)
+	}
+
+	return &secret, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Wait is how long to keep trying to reach the database, set with -wait,
+// for a database that is started along with the migrations. It replaces
+// the -connect-retries count.
+var Wait time.Duration
+
+// maxWaitBackoff caps the delay between the pings of -wait, so that a
+// database coming up is noticed soon.
+var maxWaitBackoff = 5 * time.Second
+
+// waitForDatabase pings the database until it answers, backing off like
+// pingWithRetry, and gives up once Wait has elapsed.
+func waitForDatabase(ctx context.Context, db *sql.DB, timeout, backoff time.Duration) error {
+	start := time.Now()
+	deadline := start.Add(Wait)
+	for attempt := 0; ; attempt++ {
+		err := ping(ctx, db, timeout)
+		if err == nil {
+			if attempt > 0 {
+				ui.Output(fmt.Sprintf("Database is up after %s", time.Since(start).Round(time.Millisecond)))
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return fmt.Errorf("still unreachable after waiting %s (-wait): %w", Wait, err)
+		}
+		if backoff > left {
+			backoff = left
+		}
+		ui.Output(fmt.Sprintf("Waiting for the database (%s), %s left", err, left.Round(time.Second)))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxWaitBackoff)
+	}
+}
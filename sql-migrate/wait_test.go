@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+func (*ConfigSuite) TestWaitForDatabase(c *C) {
+	defer func(previous cli.Ui) { ui = previous }(ui)
+	mock := cli.NewMockUi()
+	ui = mock
+	defer func(old time.Duration) { connectBackoff = old }(connectBackoff)
+	connectBackoff = time.Millisecond
+	defer func(old time.Duration) { maxWaitBackoff = old }(maxWaitBackoff)
+	maxWaitBackoff = 5 * time.Millisecond
+	defer func() { Wait = 0 }()
+
+	dir := filepath.Join(c.MkDir(), "missing")
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "test.db")+"?mode=ro")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	Wait = 20 * time.Millisecond
+	err = waitForDatabase(context.Background(), db, 0, connectBackoff)
+	c.Assert(err, ErrorMatches, "still unreachable after waiting 20ms \\(-wait\\): .*")
+	c.Assert(mock.OutputWriter.String(), Matches, "(?s)Waiting for the database (.*), 0s left\n.*")
+
+	// The database comes up while waiting.
+	mock.OutputWriter.Reset()
+	Wait = time.Minute
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = os.Mkdir(dir, 0o755)
+		_ = os.WriteFile(filepath.Join(dir, "test.db"), nil, 0o644)
+	}()
+	c.Assert(waitForDatabase(context.Background(), db, 0, connectBackoff), IsNil)
+	c.Assert(mock.OutputWriter.String(), Matches, "(?s)Waiting for the database (.*), 1m0s left\n.*Database is up after .*\n")
+}
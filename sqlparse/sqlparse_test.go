@@ -126,6 +126,48 @@ func (*SqlParseSuite) TestCustomTerminator(c *C) {
 	}
 }
 
+func (*SqlParseSuite) TestMysqlProcedure(c *C) {
+	migration, err := ParseMigration(strings.NewReader(mysqlProcedure))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, HasLen, 3)
+	c.Assert(migration.UpStatements[1], Equals, `
+CREATE PROCEDURE add_history(IN value VARCHAR(2000))
+BEGIN
+  DECLARE n INT;
+  SELECT COUNT(*) INTO n FROM histories;
+  INSERT INTO histories (current_value, position) VALUES (value, n + 1);
+END;
+`)
+	c.Assert(migration.UpStatements[2], Matches, `(?s)\nCREATE TRIGGER histories_touch .*END;\n`)
+	c.Assert(migration.DownStatements, HasLen, 3)
+}
+
+var mysqlProcedure = `-- +migrate Up
+CREATE TABLE histories (current_value VARCHAR(2000) NOT NULL, position INT NOT NULL, updated_at DATETIME);
+
+-- +migrate StatementBegin
+CREATE PROCEDURE add_history(IN value VARCHAR(2000))
+BEGIN
+  DECLARE n INT;
+  SELECT COUNT(*) INTO n FROM histories;
+  INSERT INTO histories (current_value, position) VALUES (value, n + 1);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER histories_touch BEFORE INSERT ON histories
+FOR EACH ROW
+BEGIN
+  SET NEW.updated_at = NOW();
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TRIGGER histories_touch;
+DROP PROCEDURE add_history;
+DROP TABLE histories;
+`
+
 var functxt = `-- +migrate Up
 CREATE TABLE IF NOT EXISTS histories (
   id                BIGSERIAL  PRIMARY KEY,
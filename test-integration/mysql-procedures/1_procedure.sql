@@ -0,0 +1,24 @@
+-- +migrate Up
+CREATE TABLE histories (current_value VARCHAR(2000) NOT NULL, position INT NOT NULL, updated_at DATETIME);
+
+-- +migrate StatementBegin
+CREATE PROCEDURE add_history(IN value VARCHAR(2000))
+BEGIN
+  DECLARE n INT;
+  SELECT COUNT(*) INTO n FROM histories;
+  INSERT INTO histories (current_value, position) VALUES (value, n + 1);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER histories_touch BEFORE INSERT ON histories
+FOR EACH ROW
+BEGIN
+  SET NEW.updated_at = NOW();
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TRIGGER histories_touch;
+DROP PROCEDURE add_history;
+DROP TABLE histories;
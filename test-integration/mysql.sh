@@ -12,3 +12,10 @@ sql-migrate up $OPTIONS
 sql-migrate down $OPTIONS
 sql-migrate redo $OPTIONS
 sql-migrate status $OPTIONS
+
+# Procedures and triggers, their semicolons within StatementBegin and
+# StatementEnd.
+OPTIONS="-config=test-integration/dbconfig.yml -env mysql_procedures"
+sql-migrate up $OPTIONS
+sql-migrate redo $OPTIONS
+sql-migrate down $OPTIONS